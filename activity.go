@@ -0,0 +1,91 @@
+package engine
+
+import "time"
+
+type ActivityType string
+
+const (
+	ActivityRegister          ActivityType = "register"
+	ActivityCreateSubReddit   ActivityType = "create_subreddit"
+	ActivityJoin              ActivityType = "join"
+	ActivityLeave             ActivityType = "leave"
+	ActivityPost              ActivityType = "post"
+	ActivityRepost            ActivityType = "repost"
+	ActivityComment           ActivityType = "comment"
+	ActivityVote              ActivityType = "vote"
+	ActivityMessage           ActivityType = "message"
+	ActivityAward             ActivityType = "award"
+	ActivityDeletePost        ActivityType = "delete_post"
+	ActivityDeleteComment     ActivityType = "delete_comment"
+	ActivityRemovePost        ActivityType = "remove_post"
+	ActivityBan               ActivityType = "ban"
+	ActivityUnban             ActivityType = "unban"
+	ActivityApproveJoin       ActivityType = "approve_join"
+	ActivityRemoveComment     ActivityType = "remove_comment"
+	ActivityReport            ActivityType = "report"
+	ActivityMergeSubReddit    ActivityType = "merge_subreddit"
+	ActivityCommentVote       ActivityType = "comment_vote"
+	ActivityRemoveVote        ActivityType = "remove_vote"
+	ActivityDeleteUser        ActivityType = "delete_user"
+	ActivityConnect           ActivityType = "connect"
+	ActivityDisconnect        ActivityType = "disconnect"
+	ActivityBlock             ActivityType = "block"
+	ActivityUnblock           ActivityType = "unblock"
+	ActivityMarkRead          ActivityType = "mark_read"
+	ActivityDeleteMessage     ActivityType = "delete_message"
+	ActivityReadNotifications ActivityType = "read_notifications"
+	ActivityAddModerator      ActivityType = "add_moderator"
+	ActivityRemoveModerator   ActivityType = "remove_moderator"
+	ActivityDenyJoin          ActivityType = "deny_join"
+	ActivityLockPost          ActivityType = "lock_post"
+	ActivityUnlockPost        ActivityType = "unlock_post"
+	ActivityPinPost           ActivityType = "pin_post"
+	ActivityUnpinPost         ActivityType = "unpin_post"
+	ActivityMarkNSFW          ActivityType = "mark_nsfw"
+	ActivityUpdateInfo        ActivityType = "update_subreddit_info"
+	ActivityEditPost          ActivityType = "edit_post"
+	ActivityEditComment       ActivityType = "edit_comment"
+	ActivitySave              ActivityType = "save"
+	ActivityUnsave            ActivityType = "unsave"
+	ActivitySchedulePost      ActivityType = "schedule_post"
+)
+
+// ActivityEvent is one entry in the engine's firehose. TargetID is the post,
+// comment, message or user acted on, and SubReddit names the community
+// involved, when either applies. Comment votes carry no voter, so their
+// UserID is 0.
+type ActivityEvent struct {
+	Type      ActivityType
+	UserID    int
+	TargetID  int
+	SubReddit string
+	Timestamp time.Time
+}
+
+// logActivity appends an event stamped with the engine clock. The log has its
+// own leaf lock, so it can be called with or without any other engine lock.
+func (e *Engine) logActivity(kind ActivityType, userID, targetID int, subReddit string) {
+	e.activityMu.Lock()
+	defer e.activityMu.Unlock()
+	e.ActivityLog = append(e.ActivityLog, ActivityEvent{
+		Type:      kind,
+		UserID:    userID,
+		TargetID:  targetID,
+		SubReddit: subReddit,
+		Timestamp: e.now(),
+	})
+}
+
+// GetActivitySince returns the events recorded at or after t in the order
+// they happened.
+func (e *Engine) GetActivitySince(t time.Time) []ActivityEvent {
+	e.activityMu.Lock()
+	defer e.activityMu.Unlock()
+	events := []ActivityEvent{}
+	for _, event := range e.ActivityLog {
+		if !event.Timestamp.Before(t) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActivityLogDistinguishesCommentVotes(t *testing.T) {
+	e := NewEngine()
+	author, _ := e.RegisterUser("author")
+	voter, _ := e.RegisterUser("voter")
+	e.CreateSubReddit(author, "sub")
+	post, _ := e.CreatePost(author, "sub", "post")
+	comment, _ := e.CommentPost(author, post, "comment")
+
+	start := len(e.ActivityLog)
+	e.UpvotePost(voter, post)
+	e.UpvoteComment(comment)
+	e.RemoveVote(voter, post)
+	e.BlockUser(voter, author)
+	e.AddModerator(author, voter, "sub")
+	e.RemoveModerator(author, voter, "sub")
+	e.DeleteUser(voter.ID)
+
+	want := []ActivityEvent{
+		{Type: ActivityVote, UserID: voter.ID, TargetID: post.ID, SubReddit: "sub"},
+		{Type: ActivityCommentVote, UserID: 0, TargetID: comment.ID, SubReddit: "sub"},
+		{Type: ActivityRemoveVote, UserID: voter.ID, TargetID: post.ID, SubReddit: "sub"},
+		{Type: ActivityBlock, UserID: voter.ID, TargetID: author.ID},
+		{Type: ActivityAddModerator, UserID: author.ID, TargetID: voter.ID, SubReddit: "sub"},
+		{Type: ActivityRemoveModerator, UserID: author.ID, TargetID: voter.ID, SubReddit: "sub"},
+		{Type: ActivityDeleteUser, UserID: voter.ID, TargetID: voter.ID},
+	}
+	got := e.ActivityLog[start:]
+	if len(got) != len(want) {
+		t.Fatalf("logged %d events, want %d: %+v", len(got), len(want), got)
+	}
+	for i, event := range got {
+		event.Timestamp = want[i].Timestamp
+		if event != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, event, want[i])
+		}
+	}
+}
+
+func TestActivityLogRecordsOperationsInOrder(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	step := func() time.Time {
+		*now = now.Add(time.Minute)
+		return *now
+	}
+
+	alice, _ := e.RegisterUser("alice")
+	t1 := step()
+	bob, _ := e.RegisterUser("bob")
+	t2 := step()
+	e.CreateSubReddit(alice, "sub")
+	t3 := step()
+	e.JoinSubReddit(bob, "sub")
+	t4 := step()
+	post, _ := e.CreatePost(bob, "sub", "post")
+	t5 := step()
+	comment, _ := e.CommentPost(alice, post, "comment")
+	t6 := step()
+	e.UpvotePost(alice, post)
+	t7 := step()
+	e.SendDirectMessage(bob, alice, "hi")
+
+	want := []ActivityEvent{
+		{Type: ActivityRegister, UserID: alice.ID, Timestamp: testEpoch},
+		{Type: ActivityRegister, UserID: bob.ID, Timestamp: t1},
+		{Type: ActivityCreateSubReddit, UserID: alice.ID, SubReddit: "sub", Timestamp: t2},
+		{Type: ActivityJoin, UserID: bob.ID, SubReddit: "sub", Timestamp: t3},
+		{Type: ActivityPost, UserID: bob.ID, TargetID: post.ID, SubReddit: "sub", Timestamp: t4},
+		{Type: ActivityComment, UserID: alice.ID, TargetID: comment.ID, SubReddit: "sub", Timestamp: t5},
+		{Type: ActivityVote, UserID: alice.ID, TargetID: post.ID, SubReddit: "sub", Timestamp: t6},
+		{Type: ActivityMessage, UserID: bob.ID, TargetID: alice.ID, Timestamp: t7},
+	}
+	all := e.GetActivitySince(time.Time{})
+	if len(all) != len(want) {
+		t.Fatalf("logged %d events, want %d: %+v", len(all), len(want), all)
+	}
+	for i := range want {
+		if all[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, all[i], want[i])
+		}
+	}
+
+	since := e.GetActivitySince(t5)
+	if len(since) != 3 || since[0] != want[5] || since[2] != want[7] {
+		t.Fatalf("GetActivitySince(t5) = %+v, want the last three events", since)
+	}
+	if got := e.GetActivitySince(t7.Add(time.Nanosecond)); len(got) != 0 {
+		t.Fatalf("GetActivitySince after the last event = %+v", got)
+	}
+}
@@ -0,0 +1,41 @@
+package engine
+
+// Award is a gift bought for CoinCost coins. Receiving one grants the author
+// KarmaBonus extra karma.
+type Award struct {
+	Name       string
+	CoinCost   int
+	KarmaBonus int
+}
+
+var (
+	AwardSilver   = Award{Name: "Silver", CoinCost: 100, KarmaBonus: 10}
+	AwardGold     = Award{Name: "Gold", CoinCost: 500, KarmaBonus: 100}
+	AwardPlatinum = Award{Name: "Platinum", CoinCost: 1800, KarmaBonus: 500}
+)
+
+func (e *Engine) GiveAward(giver *User, post *Post, award Award) {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	post.Awards = append(post.Awards, award)
+	post.awardKarma += award.KarmaBonus
+	post.Author.addPostKarma(award.KarmaBonus)
+	e.recordAward(giver)
+	e.logActivity(ActivityAward, giver.ID, post.ID, post.SubReddit)
+}
+
+func (e *Engine) GiveCommentAward(giver *User, comment *Comment, award Award) {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	comment.Awards = append(comment.Awards, award)
+	comment.Author.addCommentKarma(award.KarmaBonus)
+	e.recordAward(giver)
+	e.logActivity(ActivityAward, giver.ID, comment.ID, "")
+}
+
+func (e *Engine) recordAward(giver *User) {
+	e.TotalAwards.Add(1)
+	e.ActionBreakdown["Awards"].Add(1)
+	giver.Actions.Add(1)
+	e.TotalActions.Add(1)
+}
@@ -0,0 +1,34 @@
+package engine
+
+import "testing"
+
+func TestAwardsAreRecordedAndGrantKarma(t *testing.T) {
+	e := NewEngine()
+	author, _ := e.RegisterUser("author")
+	giver, _ := e.RegisterUser("giver")
+	e.CreateSubReddit(author, "sub")
+	post, _ := e.CreatePost(author, "sub", "post")
+	comment, _ := e.CommentPost(author, post, "comment")
+	karma := author.Karma
+
+	e.GiveAward(giver, post, AwardGold)
+	if len(post.Awards) != 1 || post.Awards[0] != AwardGold {
+		t.Fatalf("post awards = %+v", post.Awards)
+	}
+	if author.Karma != karma+AwardGold.KarmaBonus || author.PostKarma != AwardGold.KarmaBonus {
+		t.Fatalf("karma after a post award = %d (post %d)", author.Karma, author.PostKarma)
+	}
+	e.GiveCommentAward(giver, comment, AwardSilver)
+	if len(comment.Awards) != 1 || comment.Awards[0] != AwardSilver {
+		t.Fatalf("comment awards = %+v", comment.Awards)
+	}
+	if author.Karma != karma+AwardGold.KarmaBonus+AwardSilver.KarmaBonus || author.CommentKarma != AwardSilver.KarmaBonus {
+		t.Fatalf("karma after a comment award = %d (comment %d)", author.Karma, author.CommentKarma)
+	}
+	if got := e.TotalAwards.Load(); got != 2 {
+		t.Fatalf("TotalAwards = %d, want 2", got)
+	}
+	if got := e.ActionBreakdown["Awards"].Load(); got != 2 {
+		t.Fatalf(`ActionBreakdown["Awards"] = %d, want 2`, got)
+	}
+}
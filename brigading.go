@@ -0,0 +1,36 @@
+package engine
+
+import "time"
+
+// DetectBrigading reports whether at least threshold of post's current voters
+// both registered and last voted on it within the past window, by the engine
+// clock. Vote times come from the activity log.
+func (e *Engine) DetectBrigading(post *Post, window time.Duration, threshold int) bool {
+	if threshold <= 0 {
+		return false
+	}
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	since := e.now().Add(-window)
+
+	lastVote := make(map[int]time.Time)
+	e.activityMu.Lock()
+	for _, event := range e.ActivityLog {
+		if event.Type == ActivityVote && event.TargetID == post.ID {
+			lastVote[event.UserID] = event.Timestamp
+		}
+	}
+	e.activityMu.Unlock()
+
+	suspicious := 0
+	for voterID := range post.Voters {
+		voter, exists := e.Users[voterID]
+		if !exists || voter.CreatedAt.Before(since) {
+			continue
+		}
+		if voted, ok := lastVote[voterID]; ok && !voted.Before(since) {
+			suspicious++
+		}
+	}
+	return suspicious >= threshold
+}
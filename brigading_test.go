@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDetectBrigading(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	author, _ := e.RegisterUser("author")
+	e.CreateSubReddit(author, "sub")
+	var veterans []*User
+	for i := 0; i < 5; i++ {
+		user, _ := e.RegisterUser(fmt.Sprintf("veteran%d", i))
+		veterans = append(veterans, user)
+	}
+	*now = now.Add(30 * 24 * time.Hour)
+	normal, _ := e.CreatePost(author, "sub", "normal")
+	brigaded, _ := e.CreatePost(author, "sub", "brigaded")
+
+	for _, veteran := range veterans {
+		e.UpvotePost(veteran, normal)
+	}
+	for i := 0; i < 5; i++ {
+		*now = now.Add(time.Minute)
+		sock, _ := e.RegisterUser(fmt.Sprintf("sock%d", i))
+		e.DownvotePost(sock, brigaded)
+	}
+	e.UpvotePost(veterans[0], brigaded)
+
+	if e.DetectBrigading(normal, time.Hour, 3) {
+		t.Fatal("votes from established accounts were flagged")
+	}
+	if !e.DetectBrigading(brigaded, time.Hour, 3) {
+		t.Fatal("burst of votes from new accounts was not flagged")
+	}
+	if e.DetectBrigading(brigaded, time.Hour, 6) {
+		t.Fatal("flagged with fewer suspicious voters than the threshold")
+	}
+	*now = now.Add(2 * time.Hour)
+	if e.DetectBrigading(brigaded, time.Hour, 3) {
+		t.Fatal("flagged after the burst left the window")
+	}
+}
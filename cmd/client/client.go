@@ -0,0 +1,255 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	reddit "github.com/sahasgundapaneni/reddit_clone"
+)
+
+// SimConfig sizes a simulation run and sets how often each simulated
+// action happens. Rates are probabilities in [0, 1]; Max fields bound how
+// many of an action are attempted, with zero disabling it. ZipfExponent
+// skews which subreddits users join and must be greater than 1.
+type SimConfig struct {
+	NumUsers       int
+	NumSubReddits  int
+	DisconnectRate float64
+	MaxPosts       int
+	MaxVotes       int
+	UpvoteRate     float64
+	MaxComments    int
+	MaxReplies     int
+	RepostRate     float64
+	MessageRate    float64
+	ZipfExponent   float64
+}
+
+// DefaultSimConfig returns the parameters the simulation has always used.
+func DefaultSimConfig() SimConfig {
+	return SimConfig{
+		NumUsers:       100,
+		NumSubReddits:  10,
+		DisconnectRate: 0.2,
+		MaxPosts:       3,
+		MaxVotes:       5,
+		UpvoteRate:     0.7,
+		MaxComments:    2,
+		MaxReplies:     2,
+		RepostRate:     0.1,
+		MessageRate:    0.2,
+		ZipfExponent:   1.2,
+	}
+}
+
+// ZipfSelector draws indexes in [0, n) whose frequencies follow a Zipf law:
+// index k is picked in proportion to 1/(k+1)^s.
+type ZipfSelector struct {
+	zipf *rand.Zipf
+}
+
+// NewZipfSelector returns a selector over n items with exponent s, or nil
+// if n is not positive or s is not greater than 1.
+func NewZipfSelector(rng *rand.Rand, n int, s float64) *ZipfSelector {
+	if n <= 0 {
+		return nil
+	}
+	zipf := rand.NewZipf(rng, s, 1, uint64(n-1))
+	if zipf == nil {
+		return nil
+	}
+	return &ZipfSelector{zipf: zipf}
+}
+
+// Pick returns the next index.
+func (z *ZipfSelector) Pick() int {
+	return int(z.zipf.Uint64())
+}
+
+// upTo picks how many times to attempt an action: between 1 and max, or none
+// when max is not positive.
+func upTo(rng *rand.Rand, max int) int {
+	if max <= 0 {
+		return 0
+	}
+	return rng.Intn(max) + 1
+}
+
+// SimulateUsers drives a simulated workload against engine. All randomness
+// comes from rng, so a fixed seed reproduces the same run.
+func SimulateUsers(engine *reddit.Engine, cfg SimConfig, rng *rand.Rand) {
+	numUsers, numSubReddits := cfg.NumUsers, cfg.NumSubReddits
+	// Create subreddits
+	for i := 0; i < numSubReddits; i++ {
+		subRedditName := fmt.Sprintf("SubReddit%d", i+1)
+		engine.CreateSubReddit(nil, subRedditName)
+	}
+
+	usernames := make([]string, numUsers)
+	for i := range usernames {
+		usernames[i] = fmt.Sprintf("User%d", i+1)
+	}
+	users, err := engine.RegisterUsers(usernames)
+	if err != nil {
+		return
+	}
+
+	selector := NewZipfSelector(rng, numSubReddits, cfg.ZipfExponent)
+	if selector == nil {
+		return
+	}
+
+	for _, user := range users {
+		subCount := upTo(rng, numSubReddits)
+
+		// Join subreddits by Zipf rank; repeat picks are already-member no-ops
+		for j := 0; j < subCount; j++ {
+			subRedditName := fmt.Sprintf("SubReddit%d", selector.Pick()+1)
+			engine.JoinSubReddit(user, subRedditName)
+		}
+
+		// Randomly disconnect/connect users
+		if rng.Float64() > cfg.DisconnectRate {
+			engine.Connect(user)
+		} else {
+			engine.Disconnect(user)
+		}
+
+		// Create posts and comments
+		for j, n := 0, upTo(rng, cfg.MaxPosts); j < n; j++ {
+			subRedditName := fmt.Sprintf("SubReddit%d", rng.Intn(numSubReddits)+1)
+			post, err := engine.CreatePost(user, subRedditName, fmt.Sprintf("Post content %d from %s", j+1, user.Username))
+			if err == nil {
+				// Simulate random upvotes and downvotes for posts
+				var votes []reddit.VoteOp
+				for k, n := 0, upTo(rng, cfg.MaxVotes); k < n; k++ {
+					direction := -1
+					if rng.Float64() < cfg.UpvoteRate {
+						direction = 1
+					}
+					votes = append(votes, reddit.VoteOp{User: users[rng.Intn(len(users))], Post: post, Direction: direction})
+				}
+				engine.BatchVote(votes)
+
+				// Simulate comments on posts
+				for l, n := 0, upTo(rng, cfg.MaxComments); l < n; l++ {
+					comment, err := engine.CommentPost(user, post, fmt.Sprintf("Comment %d on post %d", l+1, post.ID))
+					if err != nil {
+						continue
+					}
+
+					// Simulate random upvotes and downvotes on comments
+					for v, n := 0, upTo(rng, cfg.MaxVotes); v < n; v++ {
+						if rng.Float64() < cfg.UpvoteRate {
+							engine.UpvoteComment(comment)
+						} else {
+							engine.DownvoteComment(comment)
+						}
+					}
+
+					// Simulate replies to comments
+					for m, n := 0, upTo(rng, cfg.MaxReplies); m < n; m++ {
+						engine.AddReplyToComment(user, comment, fmt.Sprintf("Reply %d to comment %d", m+1, comment.ID))
+					}
+				}
+
+				// Simulate reposts
+				if rng.Float64() < cfg.RepostRate {
+					engine.CreateRepost(user, post, fmt.Sprintf("SubReddit%d", rng.Intn(numSubReddits)+1))
+				}
+			}
+		}
+
+		// Simulate direct messages
+		if rng.Float64() < cfg.MessageRate && len(users) > 1 {
+			targetUser := users[rng.Intn(len(users))]
+			if targetUser != user {
+				engine.SendDirectMessage(user, targetUser, fmt.Sprintf("Hello from %s to %s!", user.Username, targetUser.Username))
+			}
+		}
+	}
+}
+
+func printComments(comments []*reddit.Comment, level int) {
+	indent := strings.Repeat("  ", level)
+	for _, comment := range comments {
+		fmt.Printf("%sComment ID %d by %s: %s (Votes: %d)\n", indent, comment.ID, comment.Author.Username, comment.Content, comment.Score())
+
+		if len(comment.Replies) > 0 {
+			printComments(comment.Replies, level+1)
+		}
+	}
+}
+
+func main() {
+	seed := flag.Int64("seed", time.Now().UnixNano(), "random seed for the simulation")
+	flag.Parse()
+	rng := rand.New(rand.NewSource(*seed))
+	engine := reddit.NewEngine()
+
+	// Simulate users and subreddits
+	SimulateUsers(engine, DefaultSimConfig(), rng)
+
+	stats := engine.Metrics()
+	fmt.Println("Simulation Complete. Metrics:")
+	fmt.Printf("Users: %d\n", stats.Users)
+	fmt.Printf("SubReddits: %d\n", stats.SubReddits)
+	fmt.Printf("Total Posts: %d\n", stats.TotalPosts)
+	fmt.Printf("Total Votes: %d (Upvotes: %d, Downvotes: %d)\n", stats.TotalVotes, stats.TotalUpvotes, stats.TotalDownvotes)
+	fmt.Printf("Total Comments: %d\n", stats.TotalComments)
+	fmt.Printf("Total Messages: %d\n", stats.TotalMessages)
+	fmt.Printf("Total Actions: %d\n", stats.TotalActions)
+	fmt.Printf("Throughput (actions/sec): %.2f\n", stats.Throughput)
+	fmt.Printf("Disconnected Users: %d\n", stats.DisconnectedUsers)
+
+	// Display Action Breakdown
+	fmt.Println("\nAction Breakdown:")
+	actions := make([]string, 0, len(engine.ActionBreakdown))
+	for action := range engine.ActionBreakdown {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	for _, action := range actions {
+		fmt.Printf("%s: %d\n", action, engine.ActionBreakdown[action].Load())
+	}
+
+	// Display Subreddit Metrics
+	fmt.Println("\nSubReddit Metrics (Zipf Distribution Impact):")
+	subredditStats := engine.GetTrendingSubReddits(0, 0)
+	sort.Slice(subredditStats, func(i, j int) bool {
+		return subredditStats[i].Members > subredditStats[j].Members
+	})
+
+	for i, stats := range subredditStats {
+		fmt.Printf("%d. %s - Members: %d, Posts: %d\n", i+1, stats.Name, stats.Members, stats.PostCount)
+	}
+
+	// Display Top Users by Karma
+	fmt.Println("\nTop Users by Karma:")
+	for i, user := range engine.GetTopUsersByKarma(10) {
+		fmt.Printf("%d. %s - Karma: %d\n", i+1, user.Username, user.Karma)
+	}
+
+	// Display Random User Feed
+	fmt.Println("\nFeed for a Random User:")
+	snapshot := engine.SnapshotUsers()
+	randomUser := snapshot[rng.Intn(len(snapshot))]
+	feed := engine.GetUserFeed(randomUser)
+	for _, post := range feed {
+		fmt.Printf("Post ID %d by %s: %s (Votes: %d)\n", post.ID, post.Author.Username, post.Content, post.Score())
+		if len(post.Comments) > 0 {
+			fmt.Println("  Comments:")
+			printComments(post.Comments, 1)
+		}
+	}
+
+	// Display Direct Messages
+	fmt.Println("\nDirect Messages:")
+	for _, message := range engine.Messages {
+		fmt.Printf("From %s to %s: %s\n", message.From.Username, message.To.Username, message.Content)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	reddit "github.com/sahasgundapaneni/reddit_clone"
+)
+
+// simulate runs the simulation on a fresh engine with a frozen clock, so two
+// runs can only differ through their random choices.
+func simulate(cfg SimConfig, seed int64) *reddit.Engine {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine := reddit.NewEngine()
+	engine.Clock = func() time.Time { return start }
+	engine.StartTime = start
+	SimulateUsers(engine, cfg, rand.New(rand.NewSource(seed)))
+	return engine
+}
+
+func TestSimulationIsReproducibleForASeed(t *testing.T) {
+	first, second := simulate(DefaultSimConfig(), 42), simulate(DefaultSimConfig(), 42)
+	if a, b := first.Metrics(), second.Metrics(); a != b {
+		t.Fatalf("same seed, different metrics:\n%+v\n%+v", a, b)
+	}
+	if !reflect.DeepEqual(first.ActivityLog, second.ActivityLog) {
+		t.Fatal("same seed, different activity logs")
+	}
+	if a, b := first.Metrics(), simulate(DefaultSimConfig(), 7).Metrics(); a == b {
+		t.Fatalf("different seeds produced identical metrics %+v", a)
+	}
+}
+
+func TestSimulationWithoutVotesOrReposts(t *testing.T) {
+	cfg := DefaultSimConfig()
+	cfg.MaxVotes = 0
+	cfg.RepostRate = 0
+	engine := simulate(cfg, 42)
+
+	stats := engine.Metrics()
+	if stats.TotalVotes != 0 || stats.TotalUpvotes != 0 || stats.TotalDownvotes != 0 {
+		t.Fatalf("votes recorded with MaxVotes 0: %+v", stats)
+	}
+	if stats.TotalPosts == 0 {
+		t.Fatal("simulation created no posts")
+	}
+	for _, event := range engine.ActivityLog {
+		if event.Type == reddit.ActivityRepost || event.Type == reddit.ActivityCommentVote {
+			t.Fatalf("unexpected %s event", event.Type)
+		}
+	}
+}
+
+func TestZipfSelectorFollowsZipfLaw(t *testing.T) {
+	const n, s, draws = 10, 1.2, 200000
+	selector := NewZipfSelector(rand.New(rand.NewSource(1)), n, s)
+	counts := make([]int, n)
+	for i := 0; i < draws; i++ {
+		counts[selector.Pick()]++
+	}
+
+	for k := 1; k < n; k++ {
+		want := math.Pow(float64(k+1), s)
+		if got := float64(counts[0]) / float64(counts[k]); math.Abs(got-want)/want > 0.1 {
+			t.Errorf("count[0]/count[%d] = %.2f, want about %.2f", k, got, want)
+		}
+	}
+	if NewZipfSelector(rand.New(rand.NewSource(1)), 0, s) != nil || NewZipfSelector(rand.New(rand.NewSource(1)), n, 1) != nil {
+		t.Fatal("invalid parameters should give a nil selector")
+	}
+}
+
+func TestSimulatedMembershipFollowsZipfRanking(t *testing.T) {
+	cfg := DefaultSimConfig()
+	cfg.NumUsers = 2000
+	cfg.MaxPosts, cfg.MaxComments, cfg.MaxReplies, cfg.MessageRate = 0, 0, 0, 0
+	engine := simulate(cfg, 42)
+
+	members := make([]int, cfg.NumSubReddits)
+	for i := range members {
+		members[i], _ = engine.SubscriberCount(fmt.Sprintf("SubReddit%d", i+1))
+	}
+	for i := 1; i < len(members); i++ {
+		if members[i] > members[i-1] {
+			t.Fatalf("membership by rank %v is not decreasing at rank %d", members, i+1)
+		}
+	}
+	if members[0] < 2*members[len(members)-1] {
+		t.Fatalf("membership by rank %v is too flat for a Zipf draw", members)
+	}
+}
@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+)
+
+// GetPostComments returns a copy of the post's comment tree ordered by mode
+// at every level, leaving the stored order alone. Modes are "top", "best",
+// "new" and "old"; anything else sorts by top. The copies are snapshots: act
+// on a comment through its ID, for example with GetComment.
+func (e *Engine) GetPostComments(postID int, mode string) ([]*Comment, error) {
+	post, exists := e.GetPost(postID)
+	if !exists {
+		return nil, ErrPostNotFound
+	}
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	return sortedCommentTree(post.Comments, commentOrder(mode)), nil
+}
+
+func commentOrder(mode string) func(a, b *Comment) bool {
+	switch mode {
+	case "best":
+		return func(a, b *Comment) bool {
+			if sa, sb := wilsonScore(a.Upvotes, a.Downvotes), wilsonScore(b.Upvotes, b.Downvotes); sa != sb {
+				return sa > sb
+			}
+			return a.ID < b.ID
+		}
+	case "new":
+		return func(a, b *Comment) bool {
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.After(b.CreatedAt)
+			}
+			return a.ID > b.ID
+		}
+	case "old":
+		return func(a, b *Comment) bool {
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+			return a.ID < b.ID
+		}
+	default:
+		return func(a, b *Comment) bool {
+			if sa, sb := a.Score(), b.Score(); sa != sb {
+				return sa > sb
+			}
+			return a.ID < b.ID
+		}
+	}
+}
+
+// wilsonZ is the z-score for the 80% confidence level Reddit's best sort uses.
+const wilsonZ = 1.281551565545
+
+// wilsonScore is the lower bound of the Wilson score interval for the share of
+// upvotes, so a comment needs both a good ratio and enough votes to rank well.
+func wilsonScore(upvotes, downvotes int) float64 {
+	n := float64(upvotes + downvotes)
+	if n == 0 {
+		return 0
+	}
+	p := float64(upvotes) / n
+	z2 := wilsonZ * wilsonZ
+	return (p + z2/(2*n) - wilsonZ*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+}
+
+// sortedCommentTree copies comments and, recursively, every reply beneath
+// them, sorting each level of the copy. Callers must hold e.Mutex.
+func sortedCommentTree(comments []*Comment, less func(a, b *Comment) bool) []*Comment {
+	sorted := make([]*Comment, 0, len(comments))
+	for _, comment := range comments {
+		copied := *comment
+		copied.Replies = sortedCommentTree(comment.Replies, less)
+		sorted = append(sorted, &copied)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return less(sorted[i], sorted[j])
+	})
+	return sorted
+}
+
+// VoteTally sums the upvotes and downvotes cast on every comment and reply
+// under post, without changing anything.
+func (e *Engine) VoteTally(post *Post) (up, down int) {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	return tallyComments(post.Comments)
+}
+
+func tallyComments(comments []*Comment) (up, down int) {
+	for _, comment := range comments {
+		replyUp, replyDown := tallyComments(comment.Replies)
+		up += comment.Upvotes + replyUp
+		down += comment.Downvotes + replyDown
+	}
+	return up, down
+}
+
+// countComments counts comments and all of their nested replies.
+func countComments(comments []*Comment) int {
+	count := len(comments)
+	for _, comment := range comments {
+		count += countComments(comment.Replies)
+	}
+	return count
+}
+
+// commentNode is the exported shape of a comment and its replies.
+type commentNode struct {
+	ID        int
+	Author    string
+	Content   string
+	Votes     int
+	CreatedAt time.Time
+	Replies   []commentNode
+}
+
+// CommentTreeJSON marshals the post's comments, with their nested replies,
+// in their current stored order.
+func (e *Engine) CommentTreeJSON(postID int) ([]byte, error) {
+	post, exists := e.GetPost(postID)
+	if !exists {
+		return nil, ErrPostNotFound
+	}
+	e.Mutex.RLock()
+	tree := commentNodes(post.Comments)
+	e.Mutex.RUnlock()
+	return json.Marshal(tree)
+}
+
+func commentNodes(comments []*Comment) []commentNode {
+	nodes := make([]commentNode, 0, len(comments))
+	for _, comment := range comments {
+		nodes = append(nodes, commentNode{
+			ID:        comment.ID,
+			Author:    comment.Author.Username,
+			Content:   comment.Content,
+			Votes:     comment.Score(),
+			CreatedAt: comment.CreatedAt,
+			Replies:   commentNodes(comment.Replies),
+		})
+	}
+	return nodes
+}
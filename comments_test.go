@@ -0,0 +1,254 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGetPostCommentsLeavesStoredOrder(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	post, _ := e.CreatePost(user, "sub", "post")
+	first, _ := e.CommentPost(user, post, "first")
+	second, _ := e.CommentPost(user, post, "second")
+	e.UpvoteComment(second)
+
+	before, _ := e.CommentTreeJSON(post.ID)
+	top, err := e.GetPostComments(post.ID, "top")
+	if err != nil {
+		t.Fatalf("GetPostComments: %v", err)
+	}
+	if top[0].ID != second.ID || top[1].ID != first.ID {
+		t.Fatalf("top order = %d, %d; want %d, %d", top[0].ID, top[1].ID, second.ID, first.ID)
+	}
+	after, _ := e.CommentTreeJSON(post.ID)
+	if !bytes.Equal(before, after) {
+		t.Fatalf("stored order changed:\nbefore %s\nafter  %s", before, after)
+	}
+}
+
+func TestGetPostCommentsSortsEveryLevel(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	post, _ := e.CreatePost(user, "sub", "post")
+	step := func() { *now = now.Add(time.Minute) }
+
+	a, _ := e.CommentPost(user, post, "a")
+	step()
+	b, _ := e.CommentPost(user, post, "b")
+	step()
+	c, _ := e.CommentPost(user, post, "c")
+	step()
+	r1, _ := e.AddReplyToComment(user, a, "r1")
+	step()
+	r2, _ := e.AddReplyToComment(user, a, "r2")
+	step()
+	r3, _ := e.AddReplyToComment(user, a, "r3")
+	e.UpvoteComment(b)
+	e.UpvoteComment(b)
+	e.UpvoteComment(a)
+	e.UpvoteComment(r3)
+	e.DownvoteComment(r2)
+
+	for _, tc := range []struct {
+		mode            string
+		top, underFirst []*Comment
+	}{
+		{"top", []*Comment{b, a, c}, []*Comment{r3, r1, r2}},
+		{"new", []*Comment{c, b, a}, []*Comment{r3, r2, r1}},
+		{"old", []*Comment{a, b, c}, []*Comment{r1, r2, r3}},
+		{"bogus", []*Comment{b, a, c}, []*Comment{r3, r1, r2}},
+	} {
+		comments, err := e.GetPostComments(post.ID, tc.mode)
+		if err != nil {
+			t.Fatalf("GetPostComments(%q): %v", tc.mode, err)
+		}
+		if got, want := commentIDs(comments), commentIDs(tc.top); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: top level = %v, want %v", tc.mode, got, want)
+		}
+		for _, comment := range comments {
+			if comment.ID != a.ID {
+				continue
+			}
+			if got, want := commentIDs(comment.Replies), commentIDs(tc.underFirst); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("%s: replies = %v, want %v", tc.mode, got, want)
+			}
+		}
+	}
+	if _, err := e.GetPostComments(post.ID+1, "top"); err != ErrPostNotFound {
+		t.Fatalf("GetPostComments of a missing post = %v, want ErrPostNotFound", err)
+	}
+}
+
+func TestCommentTreeJSONMatchesFixture(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	alice, _ := e.RegisterUser("alice")
+	bob, _ := e.RegisterUser("bob")
+	e.CreateSubReddit(alice, "sub")
+	post, _ := e.CreatePost(alice, "sub", "post")
+	root, _ := e.CommentPost(bob, post, "root")
+	*now = now.Add(time.Minute)
+	reply, _ := e.AddReplyToComment(alice, root, "reply")
+	*now = now.Add(time.Minute)
+	e.AddReplyToComment(bob, reply, "deepest")
+	e.UpvoteComment(root)
+	e.UpvoteComment(root)
+	e.DownvoteComment(reply)
+
+	const want = `[{"ID":1,"Author":"bob","Content":"root","Votes":2,"CreatedAt":"2024-01-01T00:00:00Z","Replies":[` +
+		`{"ID":2,"Author":"alice","Content":"reply","Votes":-1,"CreatedAt":"2024-01-01T00:01:00Z","Replies":[` +
+		`{"ID":3,"Author":"bob","Content":"deepest","Votes":0,"CreatedAt":"2024-01-01T00:02:00Z","Replies":[]}]}]}]`
+	got, err := e.CommentTreeJSON(post.ID)
+	if err != nil {
+		t.Fatalf("CommentTreeJSON: %v", err)
+	}
+	if string(got) != want {
+		t.Fatalf("CommentTreeJSON =\n%s\nwant\n%s", got, want)
+	}
+	if _, err := e.CommentTreeJSON(post.ID + 1); err != ErrPostNotFound {
+		t.Fatalf("CommentTreeJSON of a missing post = %v, want ErrPostNotFound", err)
+	}
+}
+
+func TestCommentCountIncludesNestedReplies(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	e.CreateSubReddit(mod, "sub")
+	post, _ := e.CreatePost(mod, "sub", "post")
+	first, _ := e.CommentPost(mod, post, "first")
+	e.CommentPost(mod, post, "second")
+	reply, _ := e.AddReplyToComment(mod, first, "reply")
+	e.AddReply(mod, post.ID, reply.ID, "nested")
+
+	if post.CommentCount != 4 || countComments(post.Comments) != 4 {
+		t.Fatalf("CommentCount = %d, want 4", post.CommentCount)
+	}
+	if err := e.RemoveComment(mod, post.ID, first.ID); err != nil {
+		t.Fatalf("RemoveComment: %v", err)
+	}
+	if post.CommentCount != countComments(post.Comments) {
+		t.Fatalf("after removal CommentCount = %d, tree holds %d", post.CommentCount, countComments(post.Comments))
+	}
+	if _, err := e.AddReplyToComment(mod, first, "under a removed comment"); err != nil || post.CommentCount != 5 {
+		t.Fatalf("reply under a removed comment: %v, count %d", err, post.CommentCount)
+	}
+}
+
+func TestBestSortUsesWilsonLowerBound(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	post, _ := e.CreatePost(user, "sub", "post")
+	lucky, _ := e.CommentPost(user, post, "1/0")
+	proven, _ := e.CommentPost(user, post, "10/2")
+	unvoted, _ := e.CommentPost(user, post, "0/0")
+	e.UpvoteComment(lucky)
+	for i := 0; i < 10; i++ {
+		e.UpvoteComment(proven)
+	}
+	e.DownvoteComment(proven)
+	e.DownvoteComment(proven)
+
+	best, err := e.GetPostComments(post.ID, "best")
+	if err != nil {
+		t.Fatalf("GetPostComments: %v", err)
+	}
+	if got, want := commentIDs(best), commentIDs([]*Comment{proven, lucky, unvoted}); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("best order = %v, want %v", got, want)
+	}
+	if wilsonScore(10, 2) <= wilsonScore(1, 0) || wilsonScore(0, 0) != 0 {
+		t.Fatal("wilsonScore does not favour the larger sample")
+	}
+}
+
+func TestCommentVoteCountsStayConsistent(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	post, _ := e.CreatePost(user, "sub", "post")
+	comment, _ := e.CommentPost(user, post, "comment")
+	reply, _ := e.AddReplyToComment(user, comment, "reply")
+
+	for _, up := range []bool{true, true, false, true, false, false, false} {
+		if up {
+			e.UpvoteComment(comment)
+		} else {
+			e.DownvoteComment(comment)
+		}
+	}
+	e.DownvoteComment(reply)
+	if comment.Upvotes != 3 || comment.Downvotes != 4 || comment.Score() != -1 {
+		t.Fatalf("comment up/down/score = %d/%d/%d, want 3/4/-1", comment.Upvotes, comment.Downvotes, comment.Score())
+	}
+	if reply.Upvotes != 0 || reply.Downvotes != 1 || reply.Score() != -1 {
+		t.Fatalf("reply up/down/score = %d/%d/%d, want 0/1/-1", reply.Upvotes, reply.Downvotes, reply.Score())
+	}
+	if stored, _ := e.GetComment(post.ID, comment.ID); stored.Score() != comment.Score() {
+		t.Fatal("stored comment disagrees with the returned one")
+	}
+}
+
+func TestVoteTallyIsPure(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	post, _ := e.CreatePost(user, "sub", "post")
+	comment, _ := e.CommentPost(user, post, "comment")
+	reply, _ := e.AddReplyToComment(user, comment, "reply")
+	e.UpvoteComment(comment)
+	e.UpvoteComment(comment)
+	e.DownvoteComment(reply)
+	e.UpvoteComment(reply)
+	karma := user.Karma
+	before, _ := e.CommentTreeJSON(post.ID)
+
+	up, down := e.VoteTally(post)
+	again, againDown := e.VoteTally(post)
+	if up != 3 || down != 1 || again != up || againDown != down {
+		t.Fatalf("VoteTally = %d/%d then %d/%d, want 3/1 twice", up, down, again, againDown)
+	}
+	after, _ := e.CommentTreeJSON(post.ID)
+	if !bytes.Equal(before, after) || user.Karma != karma {
+		t.Fatal("VoteTally changed votes or karma")
+	}
+}
+
+func TestDeleteCommentKeepsCommentCount(t *testing.T) {
+	e := NewEngine()
+	author, _ := e.RegisterUser("author")
+	other, _ := e.RegisterUser("other")
+	e.CreateSubReddit(author, "sub")
+	post, _ := e.CreatePost(author, "sub", "post")
+	parent, _ := e.CommentPost(author, post, "parent")
+	reply, _ := e.AddReplyToComment(author, parent, "reply")
+	e.AddReplyToComment(author, reply, "nested")
+
+	if err := e.DeleteComment(other, post.ID, reply.ID); err != ErrNotAuthorized {
+		t.Fatalf("DeleteComment by a stranger = %v, want ErrNotAuthorized", err)
+	}
+	if err := e.DeleteComment(author, post.ID, 999); err != ErrCommentNotFound {
+		t.Fatalf("DeleteComment of a missing comment = %v, want ErrCommentNotFound", err)
+	}
+	if err := e.DeleteComment(author, post.ID, reply.ID); err != nil {
+		t.Fatalf("DeleteComment: %v", err)
+	}
+	if post.CommentCount != 3 || reply.Content != "[deleted]" || reply.Author != e.DeletedUser {
+		t.Fatalf("comment with replies: count %d, content %q", post.CommentCount, reply.Content)
+	}
+	nested := reply.Replies[0]
+	if err := e.DeleteComment(author, post.ID, nested.ID); err != nil {
+		t.Fatalf("DeleteComment: %v", err)
+	}
+	if post.CommentCount != 2 || post.CommentCount != countComments(post.Comments) || len(reply.Replies) != 0 {
+		t.Fatalf("after deleting a leaf CommentCount = %d, tree holds %d", post.CommentCount, countComments(post.Comments))
+	}
+	if _, ok := e.GetComment(post.ID, nested.ID); ok {
+		t.Fatal("deleted leaf comment is still reachable")
+	}
+}
@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"math"
+	"time"
+)
+
+// ApplyKarmaDecay recomputes the karma every post credits its author, with
+// the post's votes and award bonuses discounted by its age, halving every
+// halfLife. The vote share of the change also applies to the author's karma
+// within the post's subreddit. Comment karma is left alone. A non-positive
+// halfLife does nothing.
+func (e *Engine) ApplyKarmaDecay(halfLife time.Duration) {
+	if halfLife <= 0 {
+		return
+	}
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	now := e.now()
+	for _, subreddit := range e.SubReddits {
+		subreddit.Mutex.RLock()
+		for _, post := range subreddit.Posts {
+			age := max(now.Sub(post.CreatedAt), 0)
+			factor := math.Pow(0.5, float64(age)/float64(halfLife))
+			bonus := 0
+			for _, award := range post.Awards {
+				bonus += award.KarmaBonus
+			}
+			awardKarma := int(math.Round(float64(bonus) * factor))
+			post.Author.addPostKarma(awardKarma - post.awardKarma)
+			post.awardKarma = awardKarma
+			e.creditVoteKarma(post, int(math.Round(float64(post.Score())*factor))-post.voteKarma)
+		}
+		subreddit.Mutex.RUnlock()
+	}
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyKarmaDecayKeepsSubRedditKarmaInStep(t *testing.T) {
+	e := NewEngine()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	e.Clock = func() time.Time { return now }
+	mod, _ := e.RegisterUser("mod")
+	author, _ := e.RegisterUser("author")
+	voter, _ := e.RegisterUser("voter")
+	e.CreateSubReddit(mod, "sub")
+	post, _ := e.CreatePost(author, "sub", "post")
+	e.UpvotePost(voter, post)
+
+	now = now.Add(10 * time.Hour)
+	e.ApplyKarmaDecay(time.Hour)
+	if author.PostKarma != 0 {
+		t.Fatalf("post karma = %d, want 0", author.PostKarma)
+	}
+	if got := e.GetSubRedditKarma(author, "sub"); got != 0 {
+		t.Fatalf("subreddit karma = %d, want 0", got)
+	}
+
+	if err := e.RemovePost(mod, "sub", post.ID); err != nil {
+		t.Fatalf("RemovePost: %v", err)
+	}
+	if author.PostKarma != 0 || e.GetSubRedditKarma(author, "sub") != 0 {
+		t.Fatalf("after removal karma = %d, subreddit karma = %d; want 0, 0", author.PostKarma, e.GetSubRedditKarma(author, "sub"))
+	}
+}
+
+func TestApplyKarmaDecayDiscountsOlderPosts(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	oldAuthor, _ := e.RegisterUser("old")
+	newAuthor, _ := e.RegisterUser("new")
+	voter, _ := e.RegisterUser("voter")
+	e.CreateSubReddit(oldAuthor, "sub")
+	e.VoteWeightFn = func(*User) int { return 100 }
+	oldPost, _ := e.CreatePost(oldAuthor, "sub", "old")
+	e.UpvotePost(voter, oldPost)
+	*now = now.Add(2 * time.Hour)
+	newPost, _ := e.CreatePost(newAuthor, "sub", "new")
+	e.UpvotePost(voter, newPost)
+
+	e.ApplyKarmaDecay(time.Hour)
+	if oldAuthor.PostKarma != 25 || oldAuthor.Karma != 25 {
+		t.Fatalf("two half-lives old: karma %d (post %d), want 25", oldAuthor.Karma, oldAuthor.PostKarma)
+	}
+	if newAuthor.PostKarma != 100 {
+		t.Fatalf("brand new post: karma %d, want 100", newAuthor.PostKarma)
+	}
+	if oldPost.Score() != 100 {
+		t.Fatalf("decay changed the post's score to %d", oldPost.Score())
+	}
+
+	*now = now.Add(time.Hour)
+	e.ApplyKarmaDecay(time.Hour)
+	if oldAuthor.PostKarma != 13 || newAuthor.PostKarma != 50 {
+		t.Fatalf("an hour later: old %d, new %d; want 13, 50", oldAuthor.PostKarma, newAuthor.PostKarma)
+	}
+	e.ApplyKarmaDecay(0)
+	if oldAuthor.PostKarma != 13 {
+		t.Fatal("a non-positive half-life changed karma")
+	}
+}
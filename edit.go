@@ -0,0 +1,58 @@
+package engine
+
+// EditPost replaces the content of one of author's posts and marks it edited.
+func (e *Engine) EditPost(author *User, postID int, newContent string) error {
+	if err := checkContent(newContent, e.MaxPostLength); err != nil {
+		return err
+	}
+	post, exists := e.GetPost(postID)
+	if !exists {
+		return ErrPostNotFound
+	}
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	if post.Author != author {
+		return ErrNotAuthorized
+	}
+	// Duplicate detection reads Content under the subreddit's lock alone.
+	subReddit, exists := e.SubReddits[post.SubReddit]
+	if !exists {
+		return ErrSubRedditNotFound
+	}
+	subReddit.Mutex.Lock()
+	defer subReddit.Mutex.Unlock()
+	post.Content = newContent
+	post.Edited = true
+	post.EditedAt = e.now()
+	e.logActivity(ActivityEditPost, author.ID, postID, post.SubReddit)
+	return nil
+}
+
+// EditComment replaces the content of one of author's comments or replies
+// and marks it edited. Comments a moderator has removed can't be edited.
+func (e *Engine) EditComment(author *User, postID, commentID int, newContent string) error {
+	if err := checkContent(newContent, e.MaxCommentLength); err != nil {
+		return err
+	}
+	post, exists := e.GetPost(postID)
+	if !exists {
+		return ErrPostNotFound
+	}
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	comment := findComment(post.Comments, commentID)
+	if comment == nil {
+		return ErrCommentNotFound
+	}
+	if comment.Author != author {
+		return ErrNotAuthorized
+	}
+	if comment.Removed {
+		return ErrCommentRemoved
+	}
+	comment.Content = newContent
+	comment.Edited = true
+	comment.EditedAt = e.now()
+	e.logActivity(ActivityEditComment, author.ID, commentID, post.SubReddit)
+	return nil
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEditCommentRejectsRemovedComment(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	author, _ := e.RegisterUser("author")
+	e.CreateSubReddit(mod, "sub")
+	post, _ := e.CreatePost(mod, "sub", "post")
+	comment, _ := e.CommentPost(author, post, "spam")
+
+	if err := e.RemoveComment(mod, post.ID, comment.ID); err != nil {
+		t.Fatalf("RemoveComment: %v", err)
+	}
+	if err := e.EditComment(author, post.ID, comment.ID, "spam again"); err != ErrCommentRemoved {
+		t.Fatalf("EditComment = %v, want ErrCommentRemoved", err)
+	}
+	if comment.Content != "[removed]" {
+		t.Fatalf("content = %q, want [removed]", comment.Content)
+	}
+}
+
+func TestEditPostAndComment(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	author, _ := e.RegisterUser("author")
+	other, _ := e.RegisterUser("other")
+	e.CreateSubReddit(author, "sub")
+	post, _ := e.CreatePost(author, "sub", "tpyo")
+	comment, _ := e.CommentPost(author, post, "frist")
+	reply, _ := e.AddReplyToComment(author, comment, "nested tpyo")
+	*now = now.Add(time.Hour)
+
+	if err := e.EditPost(author, post.ID, "typo"); err != nil {
+		t.Fatalf("EditPost: %v", err)
+	}
+	if post.Content != "typo" || !post.Edited || !post.EditedAt.Equal(*now) {
+		t.Fatalf("edited post = %q, edited %v at %v", post.Content, post.Edited, post.EditedAt)
+	}
+	if err := e.EditComment(author, post.ID, reply.ID, "nested typo"); err != nil {
+		t.Fatalf("EditComment: %v", err)
+	}
+	if reply.Content != "nested typo" || !reply.Edited || !reply.EditedAt.Equal(*now) || comment.Edited {
+		t.Fatalf("edited reply = %+v", reply)
+	}
+
+	if err := e.EditPost(other, post.ID, "hijacked"); err != ErrNotAuthorized {
+		t.Fatalf("EditPost by another user = %v, want ErrNotAuthorized", err)
+	}
+	if err := e.EditComment(other, post.ID, comment.ID, "hijacked"); err != ErrNotAuthorized {
+		t.Fatalf("EditComment by another user = %v, want ErrNotAuthorized", err)
+	}
+	if post.Content != "typo" || comment.Content != "frist" {
+		t.Fatal("rejected edits changed content")
+	}
+
+	if err := e.EditPost(author, post.ID+1, "x"); err != ErrPostNotFound {
+		t.Fatalf("EditPost of a missing post = %v, want ErrPostNotFound", err)
+	}
+	if err := e.EditComment(author, post.ID+1, comment.ID, "x"); err != ErrPostNotFound {
+		t.Fatalf("EditComment on a missing post = %v, want ErrPostNotFound", err)
+	}
+	if err := e.EditComment(author, post.ID, reply.ID+1, "x"); err != ErrCommentNotFound {
+		t.Fatalf("EditComment of a missing comment = %v, want ErrCommentNotFound", err)
+	}
+}
+
+func TestEditPostDuringDuplicateCheck(t *testing.T) {
+	e := NewEngine()
+	e.DetectDuplicates = true
+	author, _ := e.RegisterUser("author")
+	e.CreateSubReddit(author, "sub")
+	post, _ := e.CreatePost(author, "sub", "original")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		poster, _ := e.RegisterUser(fmt.Sprintf("poster%d", i))
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			e.EditPost(author, post.ID, fmt.Sprintf("edit %d", i))
+		}(i)
+		go func() {
+			defer wg.Done()
+			e.CreatePost(poster, "sub", "original")
+		}()
+	}
+	wg.Wait()
+	if !post.Edited {
+		t.Fatal("post was not edited")
+	}
+}
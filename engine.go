@@ -1,271 +1,1407 @@
 package engine
 
 import (
+	"errors"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
+)
+
+// Errors
+
+var (
+	ErrSubRedditNotFound = errors.New("subreddit not found")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrAlreadyMember     = errors.New("user is already a member")
+	ErrPostNotFound      = errors.New("post not found")
+	ErrCommentNotFound   = errors.New("comment not found")
+	ErrNotAuthorized     = errors.New("user is not authorized")
+	ErrBanned            = errors.New("user is banned from this subreddit")
+	ErrJoinPending       = errors.New("join request is pending approval")
+	ErrNoJoinRequest     = errors.New("no pending join request")
+	ErrMessageNotFound   = errors.New("message not found")
+	ErrNotMember         = errors.New("user is not a member")
+	ErrRateLimited       = errors.New("user is rate limited")
+	ErrInsufficientKarma = errors.New("user does not have enough karma")
+	ErrBlocked           = errors.New("recipient has blocked this user")
+	ErrQueued            = errors.New("user is offline; action queued until reconnect")
+	ErrMaxDepthExceeded  = errors.New("reply exceeds maximum comment depth")
+	ErrEmptyContent      = errors.New("content is empty")
+	ErrContentTooLong    = errors.New("content exceeds maximum length")
+	ErrUsernameTaken     = errors.New("username is already taken")
+	ErrPostLocked        = errors.New("post is locked")
+	ErrTooManyPinned     = errors.New("subreddit already has the maximum number of pinned posts")
+	ErrDuplicatePost     = errors.New("subreddit already has a post with this content")
+	ErrSameSubReddit     = errors.New("cannot merge a subreddit into itself")
+	ErrCommentRemoved    = errors.New("comment has been removed")
 )
 
 // Data Structures
 
 type User struct {
-	ID        int
-	Username  string
-	Karma     int
-	Actions   int
-	Connected bool
+	ID           int
+	Username     string
+	Karma        int
+	PostKarma    int
+	CommentKarma int
+	Actions      atomic.Int64
+	Connected    bool
+	Blocked      map[int]bool
+	Saved        map[int]bool
+	ShowNSFW     bool
+	CreatedAt    time.Time
+
+	// savedOrder lists the IDs in Saved, oldest save first.
+	savedOrder []int
 }
 
+// addPostKarma adjusts the user's post karma and keeps the Karma total in sync.
+func (u *User) addPostKarma(delta int) {
+	u.PostKarma += delta
+	u.Karma += delta
+}
+
+// addCommentKarma adjusts the user's comment karma and keeps the Karma total in sync.
+func (u *User) addCommentKarma(delta int) {
+	u.CommentKarma += delta
+	u.Karma += delta
+}
+
+// SubReddit.Mutex guards the subreddit's own posts and membership so post
+// operations in different subreddits don't contend on the engine lock.
+// Name is the lower-cased key the subreddit is stored under; DisplayName
+// keeps the casing it was created with.
 type SubReddit struct {
-	Name  string
-	Posts []*Post
-	Users map[int]*User
+	Mutex           sync.RWMutex
+	Name            string
+	DisplayName     string
+	Posts           []*Post
+	Users           map[int]*User
+	Moderators      map[int]*User
+	Banned          map[int]bool
+	Private         bool
+	PendingRequests []*User
+	RestrictPosting bool
+	MinKarmaToPost  int
+	Description     string
+	Rules           []string
+	ModLog          []ModAction
+	Reports         []Report
+
+	// merged is set, under Mutex, once MergeSubReddits has folded this
+	// subreddit into another. Writers that looked it up before the merge
+	// must treat it as gone.
+	merged bool
 }
 
 type Post struct {
-	ID       int
-	Author   *User
-	Content  string
-	Comments []Comment
-	Votes    int
+	ID             int
+	SubReddit      string
+	Author         *User
+	Content        string
+	Comments       []*Comment
+	Upvotes        int
+	Downvotes      int
+	Voters         map[int]int
+	CreatedAt      time.Time
+	OriginalPostID int
+	IsRepost       bool
+	Awards         []Award
+	Flair          string
+	IsCrossPost    bool
+	CrossPostCount int
+	CommentCount   int
+	Edited         bool
+	EditedAt       time.Time
+	Locked         bool
+	Pinned         bool
+	NSFW           bool
+	Published      bool
+	PublishAt      time.Time
+
+	// voteKarma and awardKarma are the karma the author is currently
+	// credited for the post's votes and awards, which ApplyKarmaDecay may
+	// have discounted below Score and the award bonuses. Guarded by
+	// e.Mutex.
+	voteKarma  int
+	awardKarma int
+}
+
+// Score is the post's net vote count.
+func (p *Post) Score() int {
+	return p.Upvotes - p.Downvotes
 }
 
 type Comment struct {
-	ID      int
-	Author  *User
-	Content string
-	Replies []Comment
-	Votes   int
+	ID        int
+	PostID    int
+	Author    *User
+	Content   string
+	Replies   []*Comment
+	Upvotes   int
+	Downvotes int
+	CreatedAt time.Time
+	Awards    []Award
+	Edited    bool
+	EditedAt  time.Time
+	Removed   bool
+}
+
+// Score is the comment's net vote count.
+func (c *Comment) Score() int {
+	return c.Upvotes - c.Downvotes
 }
 
 type Message struct {
+	ID      int
 	From    *User
 	To      *User
 	Content string
+	SentAt  time.Time
+	Read    bool
 }
 
+// Engine counters and ActionBreakdown entries are atomic so they can be bumped
+// and read without holding Mutex, which only guards the maps and slices. When
+// both are needed, Mutex is taken before any SubReddit.Mutex.
 type Engine struct {
 	Users             map[int]*User
+	DeletedUser       *User
 	SubReddits        map[string]*SubReddit
 	Messages          []Message
-	PostID            int
+	UserID            int
+	PostID            atomic.Int64
 	CommentID         int
-	TotalPosts        int
-	TotalVotes        int
-	TotalUpvotes      int
-	TotalDownvotes    int
-	TotalMessages     int
-	TotalActions      int
-	TotalComments     int
-	DisconnectedUsers int
+	MessageID         int
+	TotalPosts        atomic.Int64
+	TotalVotes        atomic.Int64
+	TotalUpvotes      atomic.Int64
+	TotalDownvotes    atomic.Int64
+	TotalMessages     atomic.Int64
+	TotalActions      atomic.Int64
+	TotalComments     atomic.Int64
+	TotalAwards       atomic.Int64
+	TotalReports      atomic.Int64
+	DisconnectedUsers atomic.Int64
 	StartTime         time.Time
-	Mutex             sync.Mutex
-	ActionBreakdown   map[string]int
+	Clock             func() time.Time
+	Notifications     map[int][]Notification
+	RateLimit         RateLimit
+	MaxCommentDepth   int
+	MaxPostLength     int
+	MaxCommentLength  int
+	VoteWeightFn      func(voter *User) int
+	MaxPinnedPosts    int
+	FeedLimit         int
+	DetectDuplicates  bool
+	ActivityLog       []ActivityEvent
+	Mutex             sync.RWMutex
+	ActionBreakdown   map[string]*atomic.Int64
+
+	// posts indexes every live post by ID. It has its own lock, which is
+	// never held while acquiring another.
+	posts   map[int]*Post
+	postsMu sync.RWMutex
+
+	// buckets holds each user's rate limit state under its own leaf lock.
+	buckets   map[int]*tokenBucket
+	bucketsMu sync.Mutex
+
+	activityMu sync.Mutex
+
+	// usernames maps each lower-cased username to its user ID. It is guarded
+	// by Mutex.
+	usernames map[string]int
+
+	// subRedditKarma holds each user's karma earned within each subreddit,
+	// guarded by Mutex.
+	subRedditKarma map[subRedditKarmaKey]int
+
+	// offlineActions holds, per user ID, the actions a disconnected user
+	// attempted, in order. Guarded by Mutex.
+	offlineActions map[int][]func()
+
+	// scheduled holds posts waiting for PublishDuePosts, guarded by Mutex.
+	scheduled []*Post
+
+	// subscribers holds the live feed streams opened by Subscribe under
+	// their own leaf lock.
+	subscribers   map[*feedSubscriber]struct{}
+	subscribersMu sync.Mutex
 }
 
 // Initialization and Utility Functions
 
+// Defaults applied by NewEngine. Content limits are in characters.
+const (
+	DefaultMaxPostLength    = 40000
+	DefaultMaxCommentLength = 10000
+	DefaultMaxPinnedPosts   = 2
+)
+
 func NewEngine() *Engine {
-	return &Engine{
-		Users:      make(map[int]*User),
-		SubReddits: make(map[string]*SubReddit),
-		Messages:   []Message{},
-		PostID:     1,
-		CommentID:  1,
-		StartTime:  time.Now(),
-		ActionBreakdown: map[string]int{
-			"Posts":    0,
-			"Comments": 0,
-			"Votes":    0,
-			"Messages": 0,
+	e := &Engine{
+		Users:            make(map[int]*User),
+		DeletedUser:      &User{ID: 0, Username: "[deleted]"},
+		SubReddits:       make(map[string]*SubReddit),
+		Messages:         []Message{},
+		UserID:           1,
+		CommentID:        1,
+		MessageID:        1,
+		StartTime:        time.Now(),
+		Clock:            time.Now,
+		Notifications:    make(map[int][]Notification),
+		MaxPostLength:    DefaultMaxPostLength,
+		MaxCommentLength: DefaultMaxCommentLength,
+		MaxPinnedPosts:   DefaultMaxPinnedPosts,
+		ActionBreakdown: map[string]*atomic.Int64{
+			"Posts":    {},
+			"Comments": {},
+			"Votes":    {},
+			"Messages": {},
+			"Awards":   {},
 		},
+		posts:     make(map[int]*Post),
+		buckets:   make(map[int]*tokenBucket),
+		usernames: make(map[string]int),
+
+		subRedditKarma: make(map[subRedditKarmaKey]int),
+
+		offlineActions: make(map[int][]func()),
+
+		subscribers: make(map[*feedSubscriber]struct{}),
 	}
+	e.PostID.Store(1)
+	return e
 }
 
-func (e *Engine) RegisterUser(username string) *User {
+// now reads the engine clock, falling back to time.Now when none is set.
+func (e *Engine) now() time.Time {
+	if e.Clock == nil {
+		return time.Now()
+	}
+	return e.Clock()
+}
+
+// voteWeight is how many points voter's post votes are worth. It falls back
+// to 1 when no VoteWeightFn is set and never returns less than 1. The weight
+// function runs under e.Mutex and must not call back into the engine.
+func (e *Engine) voteWeight(voter *User) int {
+	if e.VoteWeightFn == nil {
+		return 1
+	}
+	if weight := e.VoteWeightFn(voter); weight > 1 {
+		return weight
+	}
+	return 1
+}
+
+// nextPostID hands out post IDs without the engine lock, since posts are
+// created under their subreddit's lock.
+func (e *Engine) nextPostID() int {
+	return int(e.PostID.Add(1) - 1)
+}
+
+func (e *Engine) RegisterUser(username string) (*User, error) {
 	e.Mutex.Lock()
 	defer e.Mutex.Unlock()
-	id := len(e.Users) + 1
-	user := &User{ID: id, Username: username, Karma: 0, Actions: 0, Connected: true}
+	if _, taken := e.usernames[strings.ToLower(username)]; taken {
+		return nil, ErrUsernameTaken
+	}
+	return e.addUser(username), nil
+}
+
+// RegisterUsers creates every user in usernames under a single lock. If any
+// name is taken, or repeated within the batch, no users are created.
+func (e *Engine) RegisterUsers(usernames []string) ([]*User, error) {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	batch := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		key := strings.ToLower(username)
+		if _, taken := e.usernames[key]; taken || batch[key] {
+			return nil, ErrUsernameTaken
+		}
+		batch[key] = true
+	}
+	users := make([]*User, 0, len(usernames))
+	for _, username := range usernames {
+		users = append(users, e.addUser(username))
+	}
+	return users, nil
+}
+
+// addUser creates and indexes a new user. Callers must hold e.Mutex and have
+// checked the username is free.
+func (e *Engine) addUser(username string) *User {
+	id := e.UserID
+	e.UserID++
+	user := &User{ID: id, Username: username, Karma: 0, Connected: true, Blocked: make(map[int]bool), Saved: make(map[int]bool), CreatedAt: e.now()}
 	e.Users[id] = user
+	e.usernames[strings.ToLower(username)] = id
+	e.logActivity(ActivityRegister, id, 0, "")
 	return user
 }
 
-func (e *Engine) CreateSubReddit(name string) *SubReddit {
+func (e *Engine) GetUser(id int) (*User, bool) {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	user, exists := e.Users[id]
+	return user, exists
+}
+
+// SnapshotUsers copies the registered users, ordered by ID, so callers can
+// iterate them without holding the engine lock.
+func (e *Engine) SnapshotUsers() []*User {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	users := make([]*User, 0, len(e.Users))
+	for _, user := range e.Users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	return users
+}
+
+// GetUserByName looks a user up by username, ignoring case.
+func (e *Engine) GetUserByName(username string) (*User, bool) {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	return e.userByName(username)
+}
+
+// userByName resolves username through the name index. Callers must hold
+// e.Mutex.
+func (e *Engine) userByName(username string) (*User, bool) {
+	id, exists := e.usernames[strings.ToLower(username)]
+	if !exists {
+		return nil, false
+	}
+	user, exists := e.Users[id]
+	return user, exists
+}
+
+// Connect brings user back online and replays, in order, any actions they
+// attempted while disconnected.
+func (e *Engine) Connect(user *User) {
+	e.Mutex.Lock()
+	if user.Connected {
+		e.Mutex.Unlock()
+		return
+	}
+	user.Connected = true
+	e.DisconnectedUsers.Add(-1)
+	queued := e.offlineActions[user.ID]
+	delete(e.offlineActions, user.ID)
+	e.Mutex.Unlock()
+	e.logActivity(ActivityConnect, user.ID, 0, "")
+
+	for _, action := range queued {
+		action()
+	}
+}
+
+func (e *Engine) Disconnect(user *User) {
 	e.Mutex.Lock()
 	defer e.Mutex.Unlock()
-	if _, exists := e.SubReddits[name]; exists {
-		return nil
+	if !user.Connected {
+		return
 	}
-	subReddit := &SubReddit{Name: name, Posts: []*Post{}, Users: make(map[int]*User)}
-	e.SubReddits[name] = subReddit
-	return subReddit
+	user.Connected = false
+	e.DisconnectedUsers.Add(1)
+	e.logActivity(ActivityDisconnect, user.ID, 0, "")
 }
 
-func (e *Engine) JoinSubReddit(user *User, subRedditName string) bool {
+// queueIfOffline holds action for replay if user is disconnected, reporting
+// whether it did.
+func (e *Engine) queueIfOffline(user *User, action func()) bool {
 	e.Mutex.Lock()
 	defer e.Mutex.Unlock()
-	subReddit, exists := e.SubReddits[subRedditName]
-	if !exists {
+	if user.Connected {
 		return false
 	}
-	subReddit.Users[user.ID] = user
-	user.Actions++
-	e.TotalActions++
+	e.offlineActions[user.ID] = append(e.offlineActions[user.ID], action)
 	return true
 }
 
-func (e *Engine) LeaveSubReddit(user *User, subRedditName string) bool {
+func (e *Engine) BlockUser(blocker, blocked *User) {
 	e.Mutex.Lock()
 	defer e.Mutex.Unlock()
-	subReddit, exists := e.SubReddits[subRedditName]
-	if !exists {
-		return false
+	if blocker.Blocked == nil {
+		blocker.Blocked = make(map[int]bool)
 	}
-	delete(subReddit.Users, user.ID)
-	user.Actions++
-	e.TotalActions++
-	return true
+	blocker.Blocked[blocked.ID] = true
+	e.logActivity(ActivityBlock, blocker.ID, blocked.ID, "")
 }
 
-func (e *Engine) CreatePost(user *User, subRedditName, content string) *Post {
+func (e *Engine) UnblockUser(blocker, blocked *User) {
 	e.Mutex.Lock()
 	defer e.Mutex.Unlock()
+	delete(blocker.Blocked, blocked.ID)
+	e.logActivity(ActivityUnblock, blocker.ID, blocked.ID, "")
+}
+
+// hasBlocked reports whether user has blocked other. A nil other, such as a
+// message without a sender, is never blocked. Callers must hold e.Mutex.
+func hasBlocked(user, other *User) bool {
+	return other != nil && user.Blocked[other.ID]
+}
 
-	subReddit, exists := e.SubReddits[subRedditName]
+func (e *Engine) DeleteUser(userID int) error {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	user, exists := e.Users[userID]
 	if !exists {
+		return ErrUserNotFound
+	}
+	delete(e.Users, userID)
+	delete(e.usernames, strings.ToLower(user.Username))
+	for key := range e.subRedditKarma {
+		if key.userID == userID {
+			delete(e.subRedditKarma, key)
+		}
+	}
+	delete(e.offlineActions, userID)
+	pending := e.scheduled[:0]
+	for _, post := range e.scheduled {
+		if post.Author != user {
+			pending = append(pending, post)
+		}
+	}
+	e.scheduled = pending
+	if !user.Connected {
+		e.DisconnectedUsers.Add(-1)
+	}
+
+	for _, subreddit := range e.SubReddits {
+		subreddit.Mutex.Lock()
+		delete(subreddit.Users, userID)
+		delete(subreddit.Moderators, userID)
+		delete(subreddit.Banned, userID)
+		dropJoinRequest(subreddit, userID)
+		for _, post := range subreddit.Posts {
+			if post.Author == user {
+				post.Author = e.DeletedUser
+			}
+			e.reassignComments(post.Comments, user)
+		}
+		subreddit.Mutex.Unlock()
+	}
+	for i := range e.Messages {
+		if e.Messages[i].From == user {
+			e.Messages[i].From = e.DeletedUser
+		}
+		if e.Messages[i].To == user {
+			e.Messages[i].To = e.DeletedUser
+		}
+	}
+	e.logActivity(ActivityDeleteUser, userID, userID, "")
+	return nil
+}
+
+// reassignComments hands every comment by user in the tree to the deleted-user sentinel.
+func (e *Engine) reassignComments(comments []*Comment, user *User) {
+	for _, comment := range comments {
+		if comment.Author == user {
+			comment.Author = e.DeletedUser
+		}
+		e.reassignComments(comment.Replies, user)
+	}
+}
+
+// CreateSubReddit makes creator the first member and moderator of the new
+// subreddit. A nil creator leaves it unmoderated.
+func (e *Engine) CreateSubReddit(creator *User, name string) *SubReddit {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	key := subRedditKey(name)
+	if _, exists := e.SubReddits[key]; exists {
 		return nil
 	}
+	subReddit := &SubReddit{
+		Name:        key,
+		DisplayName: name,
+		Posts:       []*Post{},
+		Users:       make(map[int]*User),
+		Moderators:  make(map[int]*User),
+		Banned:      make(map[int]bool),
+	}
+	if creator != nil {
+		subReddit.Users[creator.ID] = creator
+		subReddit.Moderators[creator.ID] = creator
+	}
+	e.SubReddits[key] = subReddit
+	e.logActivity(ActivityCreateSubReddit, userID(creator), 0, key)
+	return subReddit
+}
 
-	post := &Post{
-		ID:      e.PostID,
-		Author:  user,
-		Content: content,
-		Votes:   0,
+// subRedditKey normalises a subreddit name to its map key, so names differing
+// only in case refer to the same community.
+func subRedditKey(name string) string {
+	return strings.ToLower(name)
+}
+
+func (e *Engine) GetSubReddit(name string) (*SubReddit, bool) {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	subReddit, exists := e.SubReddits[subRedditKey(name)]
+	return subReddit, exists
+}
+
+// SnapshotSubReddits copies the subreddits, ordered by name, so callers can
+// iterate them without holding the engine lock.
+func (e *Engine) SnapshotSubReddits() []*SubReddit {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	subReddits := make([]*SubReddit, 0, len(e.SubReddits))
+	for _, subReddit := range e.SubReddits {
+		subReddits = append(subReddits, subReddit)
 	}
+	sort.Slice(subReddits, func(i, j int) bool {
+		return subReddits[i].Name < subReddits[j].Name
+	})
+	return subReddits
+}
 
-	e.PostID++
-	e.TotalPosts++
-	e.ActionBreakdown["Posts"]++
-	user.Actions++
-	e.TotalActions++
+func (e *Engine) SubscriberCount(name string) (int, error) {
+	subReddit, err := e.lookupSubReddit(name)
+	if err != nil {
+		return 0, err
+	}
+	subReddit.Mutex.RLock()
+	defer subReddit.Mutex.RUnlock()
+	return len(subReddit.Users), nil
+}
 
-	subReddit.Posts = append(subReddit.Posts, post)
-	return post
+func (e *Engine) PostCount(name string) (int, error) {
+	subReddit, err := e.lookupSubReddit(name)
+	if err != nil {
+		return 0, err
+	}
+	subReddit.Mutex.RLock()
+	defer subReddit.Mutex.RUnlock()
+	return len(subReddit.Posts), nil
 }
 
-func (e *Engine) CreateRepost(user *User, originalPost *Post, subRedditName string) *Post {
+// GetSubRedditMembers returns a page of the subreddit's members ordered by
+// user ID. Offsets are clamped to the member list, and a non-positive limit
+// returns every member from offset on.
+func (e *Engine) GetSubRedditMembers(name string, offset, limit int) ([]*User, error) {
+	subReddit, err := e.lookupSubReddit(name)
+	if err != nil {
+		return nil, err
+	}
+	subReddit.Mutex.RLock()
+	members := make([]*User, 0, len(subReddit.Users))
+	for _, user := range subReddit.Users {
+		members = append(members, user)
+	}
+	subReddit.Mutex.RUnlock()
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].ID < members[j].ID
+	})
+	offset = min(max(offset, 0), len(members))
+	members = members[offset:]
+	if limit > 0 && len(members) > limit {
+		members = members[:limit]
+	}
+	return members, nil
+}
+
+// lookupSubReddit fetches a subreddit under the engine lock so the caller can
+// go on to work under just the subreddit's own lock.
+func (e *Engine) lookupSubReddit(name string) (*SubReddit, error) {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	subReddit, exists := e.SubReddits[subRedditKey(name)]
+	if !exists {
+		return nil, ErrSubRedditNotFound
+	}
+	return subReddit, nil
+}
+
+func (e *Engine) JoinSubReddit(user *User, subRedditName string) error {
+	subReddit, err := e.lookupSubReddit(subRedditName)
+	if err != nil {
+		return err
+	}
+	subReddit.Mutex.Lock()
+	defer subReddit.Mutex.Unlock()
+	if subReddit.merged {
+		return ErrSubRedditNotFound
+	}
+	if subReddit.Banned[user.ID] {
+		return ErrBanned
+	}
+	if _, member := subReddit.Users[user.ID]; member {
+		return ErrAlreadyMember
+	}
+	if subReddit.Private {
+		if pendingIndex(subReddit, user.ID) < 0 {
+			subReddit.PendingRequests = append(subReddit.PendingRequests, user)
+			user.Actions.Add(1)
+			e.TotalActions.Add(1)
+		}
+		return ErrJoinPending
+	}
+	subReddit.Users[user.ID] = user
+	user.Actions.Add(1)
+	e.TotalActions.Add(1)
+	e.logActivity(ActivityJoin, user.ID, 0, subReddit.Name)
+	return nil
+}
+
+func (e *Engine) LeaveSubReddit(user *User, subRedditName string) error {
+	subReddit, err := e.lookupSubReddit(subRedditName)
+	if err != nil {
+		return err
+	}
+	subReddit.Mutex.Lock()
+	defer subReddit.Mutex.Unlock()
+	if subReddit.merged {
+		return ErrSubRedditNotFound
+	}
+	if _, member := subReddit.Users[user.ID]; !member {
+		return ErrNotMember
+	}
+	delete(subReddit.Users, user.ID)
+	user.Actions.Add(1)
+	e.TotalActions.Add(1)
+	e.logActivity(ActivityLeave, user.ID, 0, subReddit.Name)
+	return nil
+}
+
+// LeaveAllSubReddits removes user from every subreddit they belong to, under
+// one hold of the engine lock, and returns how many they left. Each departure
+// counts as an action, as with LeaveSubReddit.
+func (e *Engine) LeaveAllSubReddits(user *User) int {
 	e.Mutex.Lock()
 	defer e.Mutex.Unlock()
+	left := 0
+	for _, subReddit := range e.SubReddits {
+		subReddit.Mutex.Lock()
+		if _, member := subReddit.Users[user.ID]; member {
+			delete(subReddit.Users, user.ID)
+			user.Actions.Add(1)
+			e.TotalActions.Add(1)
+			e.logActivity(ActivityLeave, user.ID, 0, subReddit.Name)
+			left++
+		}
+		subReddit.Mutex.Unlock()
+	}
+	return left
+}
+
+func (e *Engine) CreatePost(user *User, subRedditName, content string) (*Post, error) {
+	return e.CreatePostWithFlair(user, subRedditName, content, "")
+}
 
-	subReddit, exists := e.SubReddits[subRedditName]
+func (e *Engine) CreatePostWithFlair(user *User, subRedditName, content, flair string) (*Post, error) {
+	if err := checkContent(content, e.MaxPostLength); err != nil {
+		return nil, err
+	}
+	if e.queueIfOffline(user, func() { e.CreatePostWithFlair(user, subRedditName, content, flair) }) {
+		return nil, ErrQueued
+	}
+	e.Mutex.RLock()
+	subReddit, exists := e.SubReddits[subRedditKey(subRedditName)]
+	karma := user.Karma
+	e.Mutex.RUnlock()
+	if !exists {
+		return nil, ErrSubRedditNotFound
+	}
+	post, err := e.insertPost(subReddit, user, karma, &Post{Content: content, Flair: flair})
+	if err != nil {
+		return nil, err
+	}
+
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	e.notifyMentions(user, content, post.ID, 0)
+	return post, nil
+}
+
+// CanCreatePost reports, without changing anything, the error CreatePost
+// would return for the same arguments right now, or nil if it would succeed.
+func (e *Engine) CanCreatePost(user *User, subRedditName, content string) error {
+	if err := checkContent(content, e.MaxPostLength); err != nil {
+		return err
+	}
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	if !user.Connected {
+		return ErrQueued
+	}
+	subReddit, exists := e.SubReddits[subRedditKey(subRedditName)]
 	if !exists {
+		return ErrSubRedditNotFound
+	}
+	subReddit.Mutex.RLock()
+	defer subReddit.Mutex.RUnlock()
+	if err := checkCanPost(subReddit, user, user.Karma); err != nil {
+		return err
+	}
+	if e.DetectDuplicates && hasDuplicate(subReddit, content) {
+		return ErrDuplicatePost
+	}
+	if !e.wouldAllowAction(user) {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// insertPost checks that user may post, fills in the post's identity and
+// authorship and publishes it under the subreddit's own lock, then streams it
+// once that lock is released. Callers must not hold e.Mutex.
+func (e *Engine) insertPost(subReddit *SubReddit, user *User, karma int, post *Post) (*Post, error) {
+	subReddit.Mutex.Lock()
+	err := e.checkInsert(subReddit, user, karma, post)
+	if err == nil {
+		post.ID = e.nextPostID()
+		post.Author = user
+		e.publishPost(subReddit, post)
+	}
+	subReddit.Mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	e.streamPost(subReddit, post)
+	return post, nil
+}
+
+// checkInsert reports why post may not go into subReddit, if anything, and
+// spends one of user's rate-limited actions when it may. Reposts and
+// cross-posts are exempt from duplicate detection. Callers must hold
+// subReddit.Mutex.
+func (e *Engine) checkInsert(subReddit *SubReddit, user *User, karma int, post *Post) error {
+	if subReddit.merged {
+		return ErrSubRedditNotFound
+	}
+	if err := checkCanPost(subReddit, user, karma); err != nil {
+		return err
+	}
+	if e.DetectDuplicates && !post.IsRepost && !post.IsCrossPost && hasDuplicate(subReddit, post.Content) {
+		return ErrDuplicatePost
+	}
+	if !e.allowAction(user) {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// publishPost makes post live in subReddit, stamping it with the current time
+// and counting it. Callers must hold subReddit.Mutex, and pass the post to
+// streamPost once they have released it.
+func (e *Engine) publishPost(subReddit *SubReddit, post *Post) {
+	user := post.Author
+	post.SubReddit = subReddit.Name
+	post.Voters = make(map[int]int)
+	post.CreatedAt = e.now()
+	post.Published = true
+
+	e.TotalPosts.Add(1)
+	e.ActionBreakdown["Posts"].Add(1)
+	user.Actions.Add(1)
+	e.TotalActions.Add(1)
+
+	subReddit.Posts = append(subReddit.Posts, post)
+	e.indexPost(post)
+	kind := ActivityPost
+	if post.IsRepost {
+		kind = ActivityRepost
+	}
+	e.logActivity(kind, user.ID, post.ID, subReddit.Name)
+}
+
+// checkCanPost reports why user, currently holding karma, may not post in
+// subReddit, if anything. Moderators are never restricted. Callers must hold
+// subReddit.Mutex.
+func checkCanPost(subReddit *SubReddit, user *User, karma int) error {
+	if subReddit.Banned[user.ID] {
+		return ErrBanned
+	}
+	if isModerator(subReddit, user.ID) {
 		return nil
 	}
+	if _, member := subReddit.Users[user.ID]; subReddit.RestrictPosting && !member {
+		return ErrNotMember
+	}
+	if karma < subReddit.MinKarmaToPost {
+		return ErrInsufficientKarma
+	}
+	return nil
+}
 
-	repost := &Post{
-		ID:       e.PostID,
-		Author:   user,
-		Content:  originalPost.Content,
-		Votes:    0,
-		Comments: []Comment{},
+// hasDuplicate reports whether subReddit already has a post with exactly this
+// content. Callers must hold subReddit.Mutex.
+func hasDuplicate(subReddit *SubReddit, content string) bool {
+	for _, post := range subReddit.Posts {
+		if post.Content == content {
+			return true
+		}
 	}
+	return false
+}
 
-	e.PostID++
-	e.TotalPosts++
-	e.ActionBreakdown["Posts"]++
-	user.Actions++
-	e.TotalActions++
+// checkContent rejects blank content and content longer than max characters.
+// A non-positive max disables the length check.
+func checkContent(content string, max int) error {
+	if strings.TrimSpace(content) == "" {
+		return ErrEmptyContent
+	}
+	if max > 0 && utf8.RuneCountInString(content) > max {
+		return ErrContentTooLong
+	}
+	return nil
+}
 
-	subReddit.Posts = append(subReddit.Posts, repost)
+// CreateRepost reposts originalPost into a subreddit, subject to the same
+// posting rules as CreatePost. It returns nil if the subreddit doesn't exist
+// or the user may not post there.
+func (e *Engine) CreateRepost(user *User, originalPost *Post, subRedditName string) *Post {
+	e.Mutex.RLock()
+	subReddit, exists := e.SubReddits[subRedditKey(subRedditName)]
+	karma := user.Karma
+	content := originalPost.Content
+	e.Mutex.RUnlock()
+	if !exists {
+		return nil
+	}
+	repost, err := e.insertPost(subReddit, user, karma, &Post{
+		Content:        content,
+		Comments:       []*Comment{},
+		OriginalPostID: originalPost.ID,
+		IsRepost:       true,
+	})
+	if err != nil {
+		return nil
+	}
 	return repost
 }
 
-func (e *Engine) CommentPost(user *User, post *Post, content string) *Comment {
+// CrossPost shares originalPost into another subreddit with attribution,
+// subject to the same posting rules as CreatePost.
+func (e *Engine) CrossPost(user *User, originalPost *Post, targetSubReddit string) (*Post, error) {
+	e.Mutex.RLock()
+	subReddit, exists := e.SubReddits[subRedditKey(targetSubReddit)]
+	karma := user.Karma
+	content := originalPost.Content
+	e.Mutex.RUnlock()
+	if !exists {
+		return nil, ErrSubRedditNotFound
+	}
+	crossPost, err := e.insertPost(subReddit, user, karma, &Post{
+		Content:        content,
+		OriginalPostID: originalPost.ID,
+		IsCrossPost:    true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	e.Mutex.Lock()
 	defer e.Mutex.Unlock()
-	comment := Comment{ID: e.CommentID, Author: user, Content: content, Replies: []Comment{}, Votes: 0}
+	originalPost.CrossPostCount++
+	return crossPost, nil
+}
+
+func (e *Engine) GetReposts(postID int) []*Post {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	reposts := []*Post{}
+	for _, subreddit := range e.SubReddits {
+		subreddit.Mutex.RLock()
+		for _, post := range subreddit.Posts {
+			if post.IsRepost && post.OriginalPostID == postID {
+				reposts = append(reposts, post)
+			}
+		}
+		subreddit.Mutex.RUnlock()
+	}
+	sort.Slice(reposts, func(i, j int) bool {
+		return reposts[i].ID < reposts[j].ID
+	})
+	return reposts
+}
+
+func (e *Engine) CommentPost(user *User, post *Post, content string) (*Comment, error) {
+	if err := checkContent(content, e.MaxCommentLength); err != nil {
+		return nil, err
+	}
+	if e.queueIfOffline(user, func() { e.CommentPost(user, post, content) }) {
+		return nil, ErrQueued
+	}
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	if post.Locked {
+		return nil, ErrPostLocked
+	}
+	if !e.allowAction(user) {
+		return nil, ErrRateLimited
+	}
+	comment := &Comment{
+		ID:        e.CommentID,
+		PostID:    post.ID,
+		Author:    user,
+		Content:   content,
+		Replies:   []*Comment{},
+		CreatedAt: e.now(),
+	}
 	e.CommentID++
 	post.Comments = append(post.Comments, comment)
-	e.TotalComments++
-	e.ActionBreakdown["Comments"]++
-	user.Actions++
-	e.TotalActions++
-	return &comment
+	post.CommentCount++
+	e.notify(post.Author, Notification{Type: NotifyPostReply, FromUser: user, PostID: post.ID, CommentID: comment.ID})
+	e.notifyMentions(user, content, post.ID, comment.ID)
+	e.TotalComments.Add(1)
+	e.ActionBreakdown["Comments"].Add(1)
+	user.Actions.Add(1)
+	e.TotalActions.Add(1)
+	e.logActivity(ActivityComment, user.ID, comment.ID, post.SubReddit)
+	return comment, nil
 }
 
-func (e *Engine) AddReplyToComment(user *User, parentComment *Comment, content string) *Comment {
+func (e *Engine) AddReplyToComment(user *User, parentComment *Comment, content string) (*Comment, error) {
+	if err := checkContent(content, e.MaxCommentLength); err != nil {
+		return nil, err
+	}
+	if e.queueIfOffline(user, func() { e.AddReplyToComment(user, parentComment, content) }) {
+		return nil, ErrQueued
+	}
 	e.Mutex.Lock()
 	defer e.Mutex.Unlock()
-	reply := Comment{ID: e.CommentID, Author: user, Content: content, Replies: []Comment{}, Votes: 0}
+	return e.addReply(user, parentComment, content)
+}
+
+func (e *Engine) AddReply(user *User, postID, parentCommentID int, content string) (*Comment, error) {
+	if err := checkContent(content, e.MaxCommentLength); err != nil {
+		return nil, err
+	}
+	if e.queueIfOffline(user, func() { e.AddReply(user, postID, parentCommentID, content) }) {
+		return nil, ErrQueued
+	}
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	post, exists := e.GetPost(postID)
+	if !exists {
+		return nil, ErrPostNotFound
+	}
+	parent := findComment(post.Comments, parentCommentID)
+	if parent == nil {
+		return nil, ErrCommentNotFound
+	}
+	return e.addReply(user, parent, content)
+}
+
+// addReply appends a reply to parentComment, enforcing MaxCommentDepth when
+// it is set and the user's rate limit. Callers must have checked content and
+// must hold e.Mutex.
+func (e *Engine) addReply(user *User, parentComment *Comment, content string) (*Comment, error) {
+	post, exists := e.GetPost(parentComment.PostID)
+	if exists && post.Locked {
+		return nil, ErrPostLocked
+	}
+	if e.MaxCommentDepth > 0 {
+		if !exists {
+			return nil, ErrPostNotFound
+		}
+		if commentDepth(post.Comments, parentComment.ID, 0)+1 > e.MaxCommentDepth {
+			return nil, ErrMaxDepthExceeded
+		}
+	}
+	if !e.allowAction(user) {
+		return nil, ErrRateLimited
+	}
+	reply := &Comment{
+		ID:        e.CommentID,
+		PostID:    parentComment.PostID,
+		Author:    user,
+		Content:   content,
+		Replies:   []*Comment{},
+		CreatedAt: e.now(),
+	}
 	e.CommentID++
 	parentComment.Replies = append(parentComment.Replies, reply)
-	e.TotalComments++
-	e.ActionBreakdown["Comments"]++
-	user.Actions++
-	e.TotalActions++
-	return &reply
+	if exists {
+		post.CommentCount++
+	}
+	e.notify(parentComment.Author, Notification{Type: NotifyCommentReply, FromUser: user, PostID: reply.PostID, CommentID: reply.ID})
+	e.notifyMentions(user, content, reply.PostID, reply.ID)
+	e.TotalComments.Add(1)
+	e.ActionBreakdown["Comments"].Add(1)
+	user.Actions.Add(1)
+	e.TotalActions.Add(1)
+	e.logActivity(ActivityComment, user.ID, reply.ID, "")
+	return reply, nil
 }
 
-func (e *Engine) UpvotePost(post *Post) {
+func (e *Engine) UpvotePost(user *User, post *Post) error {
+	if e.queueIfOffline(user, func() { e.UpvotePost(user, post) }) {
+		return ErrQueued
+	}
 	e.Mutex.Lock()
 	defer e.Mutex.Unlock()
-	post.Votes++
-	post.Author.Karma++
-	e.TotalVotes++
-	e.TotalUpvotes++
-	e.ActionBreakdown["Votes"]++
-	e.TotalActions++
+	e.votePost(user, post, 1)
+	return nil
 }
 
-func (e *Engine) DownvotePost(post *Post) {
+func (e *Engine) DownvotePost(user *User, post *Post) error {
+	if e.queueIfOffline(user, func() { e.DownvotePost(user, post) }) {
+		return ErrQueued
+	}
 	e.Mutex.Lock()
 	defer e.Mutex.Unlock()
-	post.Votes--
-	post.Author.Karma--
-	e.TotalVotes++
-	e.TotalDownvotes++
-	e.ActionBreakdown["Votes"]++
-	e.TotalActions++
+	e.votePost(user, post, -1)
+	return nil
 }
 
-func (e *Engine) SendDirectMessage(from, to *User, content string) {
+// VoteOp is one vote in a BatchVote: User votes Post up for a positive
+// Direction and down for a negative one.
+type VoteOp struct {
+	User      *User
+	Post      *Post
+	Direction int
+}
+
+// BatchVote applies votes in order under a single lock acquisition, with the
+// same rules as UpvotePost and DownvotePost. Votes by offline users are
+// queued for replay, and ops with a zero Direction are ignored.
+func (e *Engine) BatchVote(votes []VoteOp) {
 	e.Mutex.Lock()
 	defer e.Mutex.Unlock()
-	message := Message{From: from, To: to, Content: content}
-	e.Messages = append(e.Messages, message)
-	e.TotalMessages++
-	e.ActionBreakdown["Messages"]++
-	from.Actions++
-	e.TotalActions++
+	for _, op := range votes {
+		direction := 1
+		switch {
+		case op.Direction == 0:
+			continue
+		case op.Direction < 0:
+			direction = -1
+		}
+		if !op.User.Connected {
+			user, post := op.User, op.Post
+			vote := e.UpvotePost
+			if direction < 0 {
+				vote = e.DownvotePost
+			}
+			e.offlineActions[user.ID] = append(e.offlineActions[user.ID], func() { vote(user, post) })
+			continue
+		}
+		e.votePost(op.User, op.Post, direction)
+	}
 }
 
-func (e *Engine) RetrieveMessages(user *User) []Message {
+func (e *Engine) RemoveVote(user *User, post *Post) bool {
 	e.Mutex.Lock()
 	defer e.Mutex.Unlock()
+	previous, voted := post.Voters[user.ID]
+	if !voted {
+		return false
+	}
+	delete(post.Voters, user.ID)
+	e.creditVoteKarma(post, -previous)
+	e.TotalVotes.Add(-1)
+	if previous > 0 {
+		post.Upvotes -= previous
+		e.TotalUpvotes.Add(-1)
+	} else {
+		post.Downvotes += previous
+		e.TotalDownvotes.Add(-1)
+	}
+	e.logActivity(ActivityRemoveVote, user.ID, post.ID, post.SubReddit)
+	return true
+}
+
+// votePost records user's vote on post in the given direction (1 or -1),
+// weighted by voteWeight. Voters keeps the signed weighted value so the vote
+// can be reversed exactly. Repeating the current direction is a no-op;
+// flipping it swings the score by both weights. Callers must hold e.Mutex.
+func (e *Engine) votePost(user *User, post *Post, direction int) {
+	if post.Voters == nil {
+		post.Voters = make(map[int]int)
+	}
+	previous := post.Voters[user.ID]
+	if previous*direction > 0 {
+		return
+	}
+	vote := direction * e.voteWeight(user)
+	post.Voters[user.ID] = vote
+	e.creditVoteKarma(post, vote-previous)
+
+	switch {
+	case previous > 0:
+		post.Upvotes -= previous
+		e.TotalUpvotes.Add(-1)
+	case previous < 0:
+		post.Downvotes += previous
+		e.TotalDownvotes.Add(-1)
+	default:
+		e.TotalVotes.Add(1)
+	}
+	if vote > 0 {
+		post.Upvotes += vote
+		e.TotalUpvotes.Add(1)
+	} else {
+		post.Downvotes -= vote
+		e.TotalDownvotes.Add(1)
+	}
+	e.ActionBreakdown["Votes"].Add(1)
+	e.TotalActions.Add(1)
+	e.logActivity(ActivityVote, user.ID, post.ID, post.SubReddit)
+}
+
+// creditVoteKarma adjusts the karma post's author holds for its votes, both
+// overall and within its subreddit. Callers must hold e.Mutex.
+func (e *Engine) creditVoteKarma(post *Post, delta int) {
+	post.voteKarma += delta
+	post.Author.addPostKarma(delta)
+	e.addSubRedditKarma(post.Author, post.SubReddit, delta)
+}
+
+type subRedditKarmaKey struct {
+	userID    int
+	subReddit string
+}
+
+// GetSubRedditKarma returns the karma user has earned from votes within the
+// named subreddit.
+func (e *Engine) GetSubRedditKarma(user *User, subRedditName string) int {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	return e.subRedditKarma[subRedditKarmaKey{user.ID, subRedditKey(subRedditName)}]
+}
+
+// addSubRedditKarma adjusts user's karma within subReddit. Callers must hold
+// e.Mutex.
+func (e *Engine) addSubRedditKarma(user *User, subReddit string, delta int) {
+	key := subRedditKarmaKey{user.ID, subReddit}
+	if karma := e.subRedditKarma[key] + delta; karma != 0 {
+		e.subRedditKarma[key] = karma
+	} else {
+		delete(e.subRedditKarma, key)
+	}
+}
+
+// addCommentSubRedditKarma credits a comment vote to the subreddit of the
+// comment's post, if that post still exists, and returns that subreddit.
+// Callers must hold e.Mutex.
+func (e *Engine) addCommentSubRedditKarma(comment *Comment, delta int) string {
+	post, exists := e.GetPost(comment.PostID)
+	if !exists {
+		return ""
+	}
+	e.addSubRedditKarma(comment.Author, post.SubReddit, delta)
+	return post.SubReddit
+}
+
+// UpvoteComment and DownvoteComment ignore removed comments, so a removal's
+// karma reversal cannot be undone by later votes.
+func (e *Engine) UpvoteComment(comment *Comment) {
+	e.Mutex.Lock()
+	if comment.Removed {
+		e.Mutex.Unlock()
+		return
+	}
+	comment.Upvotes++
+	comment.Author.addCommentKarma(1)
+	subReddit := e.addCommentSubRedditKarma(comment, 1)
+	e.Mutex.Unlock()
+	e.TotalVotes.Add(1)
+	e.TotalUpvotes.Add(1)
+	e.ActionBreakdown["Votes"].Add(1)
+	e.TotalActions.Add(1)
+	e.logActivity(ActivityCommentVote, 0, comment.ID, subReddit)
+}
+
+func (e *Engine) DownvoteComment(comment *Comment) {
+	e.Mutex.Lock()
+	if comment.Removed {
+		e.Mutex.Unlock()
+		return
+	}
+	comment.Downvotes++
+	comment.Author.addCommentKarma(-1)
+	subReddit := e.addCommentSubRedditKarma(comment, -1)
+	e.Mutex.Unlock()
+	e.TotalVotes.Add(1)
+	e.TotalDownvotes.Add(1)
+	e.ActionBreakdown["Votes"].Add(1)
+	e.TotalActions.Add(1)
+	e.logActivity(ActivityCommentVote, 0, comment.ID, subReddit)
+}
+
+func (e *Engine) SendDirectMessage(from, to *User, content string) error {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	if to.Blocked[from.ID] {
+		return ErrBlocked
+	}
+	if !e.allowAction(from) {
+		return ErrRateLimited
+	}
+	message := Message{ID: e.MessageID, From: from, To: to, Content: content, SentAt: e.now()}
+	e.MessageID++
+	e.Messages = append(e.Messages, message)
+	e.notify(to, Notification{Type: NotifyMessage, FromUser: from})
+	e.TotalMessages.Add(1)
+	e.ActionBreakdown["Messages"].Add(1)
+	from.Actions.Add(1)
+	e.TotalActions.Add(1)
+	e.logActivity(ActivityMessage, from.ID, to.ID, "")
+	return nil
+}
+
+func (e *Engine) RetrieveMessages(user *User) []Message {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
 	var userMessages []Message
 	for _, message := range e.Messages {
-		if message.To == user {
+		if addressedTo(message, user) && !hasBlocked(user, message.From) {
 			userMessages = append(userMessages, message)
 		}
 	}
 	return userMessages
 }
 
-func (e *Engine) ReplyToMessage(user *User, original Message, content string) {
-	e.SendDirectMessage(user, original.From, content)
+// MarkRead marks a message addressed to user as read. msg may be a copy
+// returned by RetrieveMessages; the stored message with the same ID is
+// updated too.
+func (e *Engine) MarkRead(user *User, msg *Message) error {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	for i := range e.Messages {
+		stored := &e.Messages[i]
+		if stored.ID != msg.ID {
+			continue
+		}
+		if !addressedTo(*stored, user) {
+			return ErrNotAuthorized
+		}
+		stored.Read = true
+		msg.Read = true
+		e.logActivity(ActivityMarkRead, user.ID, msg.ID, "")
+		return nil
+	}
+	return ErrMessageNotFound
 }
 
-func (e *Engine) GetUserFeed(user *User) []*Post {
+// DeleteMessage removes a message. Only its sender or recipient may delete it.
+func (e *Engine) DeleteMessage(user *User, msg *Message) error {
 	e.Mutex.Lock()
 	defer e.Mutex.Unlock()
+	for i, stored := range e.Messages {
+		if stored.ID != msg.ID {
+			continue
+		}
+		if !sentBy(stored, user) && !addressedTo(stored, user) {
+			return ErrNotAuthorized
+		}
+		e.Messages = append(e.Messages[:i], e.Messages[i+1:]...)
+		e.logActivity(ActivityDeleteMessage, user.ID, msg.ID, "")
+		return nil
+	}
+	return ErrMessageNotFound
+}
 
-	var feed []*Post
-	for _, subreddit := range e.SubReddits {
-		if _, subscribed := subreddit.Users[user.ID]; subscribed {
-			for _, post := range subreddit.Posts {
-				feed = append(feed, post)
-			}
+func (e *Engine) UnreadCount(user *User) int {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	count := 0
+	for _, message := range e.Messages {
+		if addressedTo(message, user) && !message.Read && !hasBlocked(user, message.From) {
+			count++
+		}
+	}
+	return count
+}
+
+// GetConversation returns the messages exchanged between two users in either
+// direction, oldest first.
+func (e *Engine) GetConversation(userA, userB *User) []Message {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	conversation := []Message{}
+	for _, message := range e.Messages {
+		if (sentBy(message, userA) && addressedTo(message, userB)) ||
+			(sentBy(message, userB) && addressedTo(message, userA)) {
+			conversation = append(conversation, message)
+		}
+	}
+	sort.SliceStable(conversation, func(i, j int) bool {
+		return conversation[i].SentAt.Before(conversation[j].SentAt)
+	})
+	return conversation
+}
+
+// addressedTo matches recipients by ID so copied User values still match.
+func addressedTo(message Message, user *User) bool {
+	return message.To != nil && message.To.ID == user.ID
+}
+
+func sentBy(message Message, user *User) bool {
+	return message.From != nil && message.From.ID == user.ID
+}
+
+func (e *Engine) ReplyToMessage(user *User, original Message, content string) error {
+	return e.SendDirectMessage(user, original.From, content)
+}
+
+func (e *Engine) GetPost(id int) (*Post, bool) {
+	e.postsMu.RLock()
+	defer e.postsMu.RUnlock()
+	post, exists := e.posts[id]
+	return post, exists
+}
+
+func (e *Engine) GetComment(postID, commentID int) (*Comment, bool) {
+	post, exists := e.GetPost(postID)
+	if !exists {
+		return nil, false
+	}
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	comment := findComment(post.Comments, commentID)
+	return comment, comment != nil
+}
+
+func (e *Engine) indexPost(post *Post) {
+	e.postsMu.Lock()
+	defer e.postsMu.Unlock()
+	e.posts[post.ID] = post
+}
+
+func (e *Engine) unindexPost(postID int) {
+	e.postsMu.Lock()
+	defer e.postsMu.Unlock()
+	delete(e.posts, postID)
+}
+
+// commentDepth returns how many replies deep commentID sits below a
+// top-level comment, which is depth 0, or -1 if it is not in the tree.
+func commentDepth(comments []*Comment, commentID, depth int) int {
+	for _, comment := range comments {
+		if comment.ID == commentID {
+			return depth
+		}
+		if found := commentDepth(comment.Replies, commentID, depth+1); found >= 0 {
+			return found
+		}
+	}
+	return -1
+}
+
+// findComment depth-first searches a comment tree for the comment with the given ID.
+func findComment(comments []*Comment, commentID int) *Comment {
+	for _, comment := range comments {
+		if comment.ID == commentID {
+			return comment
+		}
+		if found := findComment(comment.Replies, commentID); found != nil {
+			return found
 		}
 	}
-	return feed
+	return nil
 }
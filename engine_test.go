@@ -0,0 +1,1559 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCreateRepostFollowsPostingRules(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(mod, "origin")
+	e.CreateSubReddit(mod, "target")
+	original, err := e.CreatePost(mod, "origin", "original")
+	if err != nil {
+		t.Fatalf("CreatePost: %v", err)
+	}
+	if err := e.BanUser(mod, user, "target"); err != nil {
+		t.Fatalf("BanUser: %v", err)
+	}
+	if repost := e.CreateRepost(user, original, "target"); repost != nil {
+		t.Fatalf("banned user reposted as post %d", repost.ID)
+	}
+
+	stream, cancel := e.Subscribe(mod)
+	defer cancel()
+	repost := e.CreateRepost(mod, original, "target")
+	if repost == nil || !repost.IsRepost || repost.OriginalPostID != original.ID {
+		t.Fatalf("CreateRepost = %+v, want a repost of %d", repost, original.ID)
+	}
+	if got := <-stream; got != repost {
+		t.Fatalf("subscriber got post %d, want repost %d", got.ID, repost.ID)
+	}
+}
+
+func TestDeleteUserClearsJoinRequestsAndBans(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	pending, _ := e.RegisterUser("pending")
+	banned, _ := e.RegisterUser("banned")
+	private := e.CreateSubReddit(mod, "private")
+	private.Private = true
+	e.CreateSubReddit(mod, "public")
+	if err := e.JoinSubReddit(pending, "private"); err != ErrJoinPending {
+		t.Fatalf("JoinSubReddit = %v, want ErrJoinPending", err)
+	}
+	e.BanUser(mod, banned, "public")
+
+	e.DeleteUser(pending.ID)
+	e.DeleteUser(banned.ID)
+	if err := e.ApproveJoinRequest(mod, pending, "private"); err != ErrNoJoinRequest {
+		t.Fatalf("ApproveJoinRequest = %v, want ErrNoJoinRequest", err)
+	}
+	if _, member := private.Users[pending.ID]; member {
+		t.Fatal("deleted user was admitted")
+	}
+	public, _ := e.GetSubReddit("public")
+	if public.Banned[banned.ID] {
+		t.Fatal("deleted user is still on the ban list")
+	}
+}
+
+func TestUpvotingReturnedCommentUpdatesStoredComment(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	post, _ := e.CreatePost(user, "sub", "post")
+	comment, err := e.CommentPost(user, post, "comment")
+	if err != nil {
+		t.Fatalf("CommentPost: %v", err)
+	}
+
+	e.UpvoteComment(comment)
+	stored, ok := e.GetPost(post.ID)
+	if !ok {
+		t.Fatalf("post %d not found", post.ID)
+	}
+	if got := stored.Comments[0].Score(); got != 1 {
+		t.Fatalf("stored comment score = %d, want 1", got)
+	}
+	if stored.Comments[0] != comment {
+		t.Fatal("CommentPost returned a copy of the stored comment")
+	}
+}
+
+func TestAddReplyBuildsNestedThread(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	post, _ := e.CreatePost(user, "sub", "post")
+	root, _ := e.CommentPost(user, post, "root")
+	child, err := e.AddReply(user, post.ID, root.ID, "child")
+	if err != nil {
+		t.Fatalf("AddReply child: %v", err)
+	}
+	grandchild, err := e.AddReply(user, post.ID, child.ID, "grandchild")
+	if err != nil {
+		t.Fatalf("AddReply grandchild: %v", err)
+	}
+
+	got, ok := e.GetComment(post.ID, root.ID)
+	if !ok {
+		t.Fatalf("comment %d not found", root.ID)
+	}
+	if len(got.Replies) != 1 || got.Replies[0] != child {
+		t.Fatalf("root replies = %v, want [%d]", got.Replies, child.ID)
+	}
+	if len(child.Replies) != 1 || child.Replies[0] != grandchild {
+		t.Fatalf("child replies = %v, want [%d]", child.Replies, grandchild.ID)
+	}
+	if found, ok := e.GetComment(post.ID, grandchild.ID); !ok || found != grandchild {
+		t.Fatal("GetComment did not find the grandchild")
+	}
+	if _, err := e.AddReply(user, post.ID, 999, "orphan"); err != ErrCommentNotFound {
+		t.Fatalf("AddReply to missing parent = %v, want ErrCommentNotFound", err)
+	}
+}
+
+func TestCommentVotesUpdateEngineCounters(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	post, _ := e.CreatePost(user, "sub", "post")
+	comment, _ := e.CommentPost(user, post, "comment")
+
+	for i := 0; i < 3; i++ {
+		e.UpvoteComment(comment)
+	}
+	e.DownvoteComment(comment)
+
+	if got := e.TotalVotes.Load(); got != 4 {
+		t.Errorf("TotalVotes = %d, want 4", got)
+	}
+	if got := e.TotalUpvotes.Load(); got != 3 {
+		t.Errorf("TotalUpvotes = %d, want 3", got)
+	}
+	if got := e.TotalDownvotes.Load(); got != 1 {
+		t.Errorf("TotalDownvotes = %d, want 1", got)
+	}
+	if got := e.ActionBreakdown["Votes"].Load(); got != 4 {
+		t.Errorf("Votes breakdown = %d, want 4", got)
+	}
+	if comment.Score() != 2 || user.Karma != 2 {
+		t.Errorf("score = %d, karma = %d; want 2, 2", comment.Score(), user.Karma)
+	}
+}
+
+// newVoteFixture returns an engine with an author's post and a separate voter.
+func newVoteFixture(t *testing.T) (*Engine, *User, *User, *Post) {
+	t.Helper()
+	e := NewEngine()
+	author, _ := e.RegisterUser("author")
+	voter, _ := e.RegisterUser("voter")
+	e.CreateSubReddit(author, "sub")
+	post, err := e.CreatePost(author, "sub", "post")
+	if err != nil {
+		t.Fatalf("CreatePost: %v", err)
+	}
+	return e, author, voter, post
+}
+
+func TestRepeatedUpvoteIsNoOp(t *testing.T) {
+	e, author, voter, post := newVoteFixture(t)
+	e.UpvotePost(voter, post)
+	e.UpvotePost(voter, post)
+	if post.Score() != 1 || author.Karma != 1 {
+		t.Fatalf("score = %d, karma = %d; want 1, 1", post.Score(), author.Karma)
+	}
+}
+
+func TestSwitchingUpvoteToDownvoteSwingsByTwo(t *testing.T) {
+	e, author, voter, post := newVoteFixture(t)
+	e.UpvotePost(voter, post)
+	e.DownvotePost(voter, post)
+	if post.Score() != -1 || author.Karma != -1 {
+		t.Fatalf("score = %d, karma = %d; want -1, -1", post.Score(), author.Karma)
+	}
+	if post.Voters[voter.ID] != -1 {
+		t.Fatalf("recorded vote = %d, want -1", post.Voters[voter.ID])
+	}
+}
+
+func TestRemovingDownvoteRestoresScore(t *testing.T) {
+	e, author, voter, post := newVoteFixture(t)
+	e.DownvotePost(voter, post)
+	e.RemoveVote(voter, post)
+	if post.Score() != 0 || author.Karma != 0 {
+		t.Fatalf("score = %d, karma = %d; want 0, 0", post.Score(), author.Karma)
+	}
+}
+
+func TestRemoveVoteRevertsUpvote(t *testing.T) {
+	e, author, voter, post := newVoteFixture(t)
+	e.UpvotePost(voter, post)
+	if !e.RemoveVote(voter, post) {
+		t.Fatal("RemoveVote = false, want true")
+	}
+	if post.Score() != 0 || author.Karma != 0 {
+		t.Fatalf("score = %d, karma = %d; want 0, 0", post.Score(), author.Karma)
+	}
+	if e.TotalVotes.Load() != 0 || e.TotalUpvotes.Load() != 0 {
+		t.Fatalf("TotalVotes = %d, TotalUpvotes = %d; want 0, 0", e.TotalVotes.Load(), e.TotalUpvotes.Load())
+	}
+	if _, voted := post.Voters[voter.ID]; voted {
+		t.Fatal("voter still recorded on the post")
+	}
+}
+
+func TestRemoveVoteRevertsDownvote(t *testing.T) {
+	e, author, voter, post := newVoteFixture(t)
+	e.DownvotePost(voter, post)
+	if !e.RemoveVote(voter, post) {
+		t.Fatal("RemoveVote = false, want true")
+	}
+	if post.Score() != 0 || author.Karma != 0 {
+		t.Fatalf("score = %d, karma = %d; want 0, 0", post.Score(), author.Karma)
+	}
+	if e.TotalVotes.Load() != 0 || e.TotalDownvotes.Load() != 0 {
+		t.Fatalf("TotalVotes = %d, TotalDownvotes = %d; want 0, 0", e.TotalVotes.Load(), e.TotalDownvotes.Load())
+	}
+}
+
+func TestRemoveVoteWithoutVote(t *testing.T) {
+	e, _, voter, post := newVoteFixture(t)
+	if e.RemoveVote(voter, post) {
+		t.Fatal("RemoveVote = true for a user who never voted")
+	}
+	if e.TotalVotes.Load() != 0 {
+		t.Fatalf("TotalVotes = %d, want 0", e.TotalVotes.Load())
+	}
+}
+
+func TestUserIDsSurviveDeletion(t *testing.T) {
+	e := NewEngine()
+	first, _ := e.RegisterUser("first")
+	middle, _ := e.RegisterUser("middle")
+	third, _ := e.RegisterUser("third")
+	if err := e.DeleteUser(middle.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	fourth, _ := e.RegisterUser("fourth")
+
+	ids := map[int]bool{}
+	for _, user := range []*User{first, middle, third, fourth} {
+		if ids[user.ID] {
+			t.Fatalf("ID %d assigned twice", user.ID)
+		}
+		ids[user.ID] = true
+	}
+	for _, user := range []*User{first, third, fourth} {
+		if got, ok := e.GetUser(user.ID); !ok || got != user {
+			t.Fatalf("user %d was clobbered", user.ID)
+		}
+	}
+}
+
+func TestDeleteUserCleansUpMembershipsAndContent(t *testing.T) {
+	e := NewEngine()
+	reader, _ := e.RegisterUser("reader")
+	gone, _ := e.RegisterUser("gone")
+	e.CreateSubReddit(reader, "sub")
+	e.CreateSubReddit(gone, "other")
+	e.JoinSubReddit(gone, "sub")
+	post, _ := e.CreatePost(gone, "sub", "post")
+	comment, _ := e.CommentPost(gone, post, "comment")
+	e.SendDirectMessage(gone, reader, "hello")
+
+	if err := e.DeleteUser(gone.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, ok := e.GetUser(gone.ID); ok {
+		t.Fatal("deleted user is still registered")
+	}
+	for _, name := range []string{"sub", "other"} {
+		subReddit, _ := e.GetSubReddit(name)
+		if _, member := subReddit.Users[gone.ID]; member {
+			t.Fatalf("deleted user is still a member of %s", name)
+		}
+	}
+	if post.Author != e.DeletedUser || comment.Author != e.DeletedUser {
+		t.Fatal("authored content was not handed to the deleted-user sentinel")
+	}
+	if messages := e.RetrieveMessages(reader); len(messages) != 1 || messages[0].From != e.DeletedUser {
+		t.Fatalf("messages = %+v, want one from the deleted-user sentinel", messages)
+	}
+	if feed := e.GetUserFeed(reader); len(feed) != 1 {
+		t.Fatalf("feed has %d posts, want 1", len(feed))
+	}
+	if err := e.DeleteUser(gone.ID); err != ErrUserNotFound {
+		t.Fatalf("second DeleteUser = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(nil, "sub")
+
+	if err := e.JoinSubReddit(user, "missing"); err != ErrSubRedditNotFound {
+		t.Errorf("JoinSubReddit missing = %v, want ErrSubRedditNotFound", err)
+	}
+	if err := e.JoinSubReddit(user, "sub"); err != nil {
+		t.Errorf("JoinSubReddit = %v, want nil", err)
+	}
+	if err := e.JoinSubReddit(user, "sub"); err != ErrAlreadyMember {
+		t.Errorf("second JoinSubReddit = %v, want ErrAlreadyMember", err)
+	}
+	if post, err := e.CreatePost(user, "missing", "post"); err != ErrSubRedditNotFound || post != nil {
+		t.Errorf("CreatePost missing = %v, %v; want nil, ErrSubRedditNotFound", post, err)
+	}
+	if post, err := e.CreatePost(user, "sub", "post"); err != nil || post == nil {
+		t.Errorf("CreatePost = %v, %v; want a post", post, err)
+	}
+	if err := e.DeleteUser(999); err != ErrUserNotFound {
+		t.Errorf("DeleteUser missing = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestLookupsAreSafeDuringRegistration(t *testing.T) {
+	e := NewEngine()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				name := fmt.Sprintf("user%d_%d", i, j)
+				user, _ := e.RegisterUser(name)
+				e.CreateSubReddit(user, name)
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := 1; id <= 200; id++ {
+				if user, ok := e.GetUser(id); ok && user.ID != id {
+					t.Errorf("GetUser(%d) returned user %d", id, user.ID)
+				}
+				e.GetSubReddit(fmt.Sprintf("user%d_%d", i, id%50))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, ok := e.GetUser(999); ok {
+		t.Error("GetUser found a user that was never registered")
+	}
+	if subReddit, ok := e.GetSubReddit("user0_0"); !ok || subReddit == nil {
+		t.Error("GetSubReddit did not find a created subreddit")
+	}
+}
+
+// setClock makes e read the time from the returned variable, so a test can
+// move the clock by assigning to it.
+func setClock(e *Engine, start time.Time) *time.Time {
+	now := start
+	e.Clock = func() time.Time { return now }
+	return &now
+}
+
+// testEpoch is the fixed start time tests set their engine clocks to.
+var testEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestCreatedAtUsesEngineClock(t *testing.T) {
+	e := NewEngine()
+	setClock(e, testEpoch)
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	post, _ := e.CreatePost(user, "sub", "post")
+	repost := e.CreateRepost(user, post, "sub")
+	comment, _ := e.CommentPost(user, post, "comment")
+	reply, _ := e.AddReplyToComment(user, comment, "reply")
+
+	for name, got := range map[string]time.Time{
+		"post":    post.CreatedAt,
+		"repost":  repost.CreatedAt,
+		"comment": comment.CreatedAt,
+		"reply":   reply.CreatedAt,
+	} {
+		if !got.Equal(testEpoch) {
+			t.Errorf("%s CreatedAt = %v, want %v", name, got, testEpoch)
+		}
+	}
+}
+
+func TestRepostsLinkBackToOriginal(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	e.CreateSubReddit(user, "other")
+	original, _ := e.CreatePost(user, "sub", "original")
+	unrelated, _ := e.CreatePost(user, "sub", "unrelated")
+	first := e.CreateRepost(user, original, "other")
+	second := e.CreateRepost(user, original, "sub")
+
+	if !first.IsRepost || first.OriginalPostID != original.ID {
+		t.Fatalf("repost = {IsRepost: %v, OriginalPostID: %d}, want {true, %d}", first.IsRepost, first.OriginalPostID, original.ID)
+	}
+	if original.IsRepost || original.OriginalPostID != 0 {
+		t.Fatal("original post is marked as a repost")
+	}
+	got := postIDs(e.GetReposts(original.ID))
+	if want := []int{first.ID, second.ID}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("GetReposts = %v, want %v", got, want)
+	}
+	if reposts := e.GetReposts(unrelated.ID); len(reposts) != 0 {
+		t.Fatalf("GetReposts(unrelated) = %v, want none", postIDs(reposts))
+	}
+}
+
+func TestPostAndCommentKarmaAreTrackedSeparately(t *testing.T) {
+	e, author, voter, post := newVoteFixture(t)
+	comment, _ := e.CommentPost(author, post, "comment")
+
+	e.UpvotePost(voter, post)
+	e.DownvoteComment(comment)
+	e.DownvoteComment(comment)
+
+	if author.PostKarma != 1 {
+		t.Errorf("PostKarma = %d, want 1", author.PostKarma)
+	}
+	if author.CommentKarma != -2 {
+		t.Errorf("CommentKarma = %d, want -2", author.CommentKarma)
+	}
+	if author.Karma != author.PostKarma+author.CommentKarma {
+		t.Errorf("Karma = %d, want PostKarma+CommentKarma = %d", author.Karma, author.PostKarma+author.CommentKarma)
+	}
+}
+
+func TestConcurrentVotesKeepCountersExact(t *testing.T) {
+	e := NewEngine()
+	author, _ := e.RegisterUser("author")
+	e.CreateSubReddit(author, "sub")
+	post, _ := e.CreatePost(author, "sub", "post")
+	voters := make([]*User, 50)
+	for i := range voters {
+		voters[i], _ = e.RegisterUser(fmt.Sprintf("voter%d", i))
+	}
+
+	var wg sync.WaitGroup
+	for i, voter := range voters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				e.UpvotePost(voter, post)
+			} else {
+				e.DownvotePost(voter, post)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if e.TotalVotes.Load() != 50 || e.TotalUpvotes.Load() != 25 || e.TotalDownvotes.Load() != 25 {
+		t.Fatalf("votes = %d (%d up, %d down), want 50 (25 up, 25 down)", e.TotalVotes.Load(), e.TotalUpvotes.Load(), e.TotalDownvotes.Load())
+	}
+	if e.TotalActions.Load() != 51 {
+		t.Fatalf("TotalActions = %d, want 51", e.TotalActions.Load())
+	}
+}
+
+func BenchmarkConcurrentVotes(b *testing.B) {
+	e := NewEngine()
+	author, _ := e.RegisterUser("author")
+	e.CreateSubReddit(author, "sub")
+	posts := make([]*Post, 64)
+	for i := range posts {
+		posts[i], _ = e.CreatePost(author, "sub", fmt.Sprintf("post %d", i))
+	}
+	voter, _ := e.RegisterUser("voter")
+	var next atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		post := posts[next.Add(1)%int64(len(posts))]
+		for i := 0; pb.Next(); i++ {
+			if i%2 == 0 {
+				e.UpvotePost(voter, post)
+			} else {
+				e.DownvotePost(voter, post)
+			}
+		}
+	})
+}
+
+func TestConcurrentPostsIntoDistinctSubReddits(t *testing.T) {
+	e := NewEngine()
+	const subReddits, perSub = 4, 25
+	users := make([]*User, subReddits)
+	for i := range users {
+		users[i], _ = e.RegisterUser(fmt.Sprintf("user%d", i))
+		e.CreateSubReddit(users[i], fmt.Sprintf("sub%d", i))
+	}
+
+	var wg sync.WaitGroup
+	for i, user := range users {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("sub%d", i)
+			for j := 0; j < perSub; j++ {
+				post, err := e.CreatePost(user, name, fmt.Sprintf("post %d", j))
+				if err != nil {
+					t.Errorf("CreatePost: %v", err)
+					return
+				}
+				e.CreateRepost(user, post, name)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := range users {
+		if count, _ := e.PostCount(fmt.Sprintf("sub%d", i)); count != 2*perSub {
+			t.Errorf("sub%d has %d posts, want %d", i, count, 2*perSub)
+		}
+	}
+	if got := e.TotalPosts.Load(); got != subReddits*perSub*2 {
+		t.Fatalf("TotalPosts = %d, want %d", got, subReddits*perSub*2)
+	}
+}
+
+func BenchmarkPostsIntoDistinctSubReddits(b *testing.B) {
+	e := NewEngine()
+	const subReddits = 16
+	users := make([]*User, subReddits)
+	for i := range users {
+		users[i], _ = e.RegisterUser(fmt.Sprintf("user%d", i))
+		e.CreateSubReddit(users[i], fmt.Sprintf("sub%d", i))
+	}
+	var next atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(next.Add(1) % subReddits)
+		user, name := users[i], fmt.Sprintf("sub%d", i)
+		for pb.Next() {
+			e.CreatePost(user, name, "post")
+		}
+	})
+}
+
+func TestGetConversationInterleavesBothDirections(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	alice, _ := e.RegisterUser("alice")
+	bob, _ := e.RegisterUser("bob")
+	carol, _ := e.RegisterUser("carol")
+
+	for i, send := range []struct{ from, to *User }{{alice, bob}, {bob, alice}, {alice, carol}, {alice, bob}} {
+		*now = testEpoch.Add(time.Duration(i) * time.Minute)
+		e.SendDirectMessage(send.from, send.to, fmt.Sprintf("message %d", i))
+	}
+
+	conversation := e.GetConversation(bob, alice)
+	var got []string
+	for _, message := range conversation {
+		got = append(got, message.Content)
+	}
+	if want := "[message 0 message 1 message 3]"; fmt.Sprint(got) != want {
+		t.Fatalf("conversation = %v, want %s", got, want)
+	}
+	for i := 1; i < len(conversation); i++ {
+		if conversation[i].SentAt.Before(conversation[i-1].SentAt) {
+			t.Fatal("conversation is not in send order")
+		}
+	}
+}
+
+func TestUnreadCountDropsAsMessagesAreRead(t *testing.T) {
+	e := NewEngine()
+	alice, _ := e.RegisterUser("alice")
+	bob, _ := e.RegisterUser("bob")
+	for i := 0; i < 3; i++ {
+		e.SendDirectMessage(alice, bob, fmt.Sprintf("message %d", i))
+	}
+	e.SendDirectMessage(bob, alice, "reply")
+
+	if got := e.UnreadCount(bob); got != 3 {
+		t.Fatalf("UnreadCount = %d, want 3", got)
+	}
+	inbox := e.RetrieveMessages(bob)
+	for i := range inbox {
+		if err := e.MarkRead(bob, &inbox[i]); err != nil {
+			t.Fatalf("MarkRead: %v", err)
+		}
+		if got, want := e.UnreadCount(bob), len(inbox)-i-1; got != want {
+			t.Fatalf("UnreadCount after %d reads = %d, want %d", i+1, got, want)
+		}
+	}
+	if err := e.MarkRead(alice, &inbox[0]); err != ErrNotAuthorized {
+		t.Fatalf("MarkRead by sender = %v, want ErrNotAuthorized", err)
+	}
+	if got := e.UnreadCount(alice); got != 1 {
+		t.Fatalf("sender's UnreadCount = %d, want 1", got)
+	}
+}
+
+func TestRetrieveMessagesMatchesRecipientsByID(t *testing.T) {
+	e := NewEngine()
+	alice, _ := e.RegisterUser("alice")
+	bob, _ := e.RegisterUser("bob")
+	carol, _ := e.RegisterUser("carol")
+	e.SendDirectMessage(alice, bob, "to bob")
+	e.SendDirectMessage(alice, carol, "to carol")
+	e.Messages = append(e.Messages, Message{ID: e.MessageID, From: alice, Content: "no recipient"})
+
+	if got := e.RetrieveMessages(&User{ID: carol.ID}); len(got) != 1 || got[0].Content != "to carol" {
+		t.Fatalf("RetrieveMessages for a copy of carol = %+v", got)
+	}
+	if err := e.DeleteUser(bob.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if got := e.RetrieveMessages(alice); len(got) != 0 {
+		t.Fatalf("sender retrieved %d messages, want 0", len(got))
+	}
+	if got := e.RetrieveMessages(carol); len(got) != 1 {
+		t.Fatalf("carol retrieved %d messages, want 1", len(got))
+	}
+	if got := e.RetrieveMessages(e.DeletedUser); len(got) != 1 || got[0].Content != "to bob" {
+		t.Fatalf("RetrieveMessages for the sentinel = %+v", got)
+	}
+}
+
+func TestVoteCountsStayConsistent(t *testing.T) {
+	e, _, voter, post := newVoteFixture(t)
+	other, _ := e.RegisterUser("other")
+	third, _ := e.RegisterUser("third")
+	check := func(step string, up, down int) {
+		t.Helper()
+		if post.Upvotes != up || post.Downvotes != down || post.Score() != up-down {
+			t.Fatalf("after %s: up=%d down=%d score=%d, want %d/%d/%d",
+				step, post.Upvotes, post.Downvotes, post.Score(), up, down, up-down)
+		}
+	}
+
+	e.UpvotePost(voter, post)
+	e.UpvotePost(other, post)
+	e.DownvotePost(third, post)
+	check("mixed votes", 2, 1)
+	e.DownvotePost(voter, post)
+	check("switching to a downvote", 1, 2)
+	e.RemoveVote(third, post)
+	check("removing a downvote", 1, 1)
+	e.RemoveVote(other, post)
+	e.RemoveVote(other, post)
+	check("removing an upvote twice", 0, 1)
+	e.RemoveVote(voter, post)
+	check("removing every vote", 0, 0)
+}
+
+func TestGetPost(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	post, _ := e.CreatePost(user, "sub", "post")
+
+	if got, ok := e.GetPost(post.ID); !ok || got != post {
+		t.Fatalf("GetPost(%d) = %v, %v", post.ID, got, ok)
+	}
+	if got, ok := e.GetPost(post.ID + 1); ok || got != nil {
+		t.Fatalf("GetPost of a missing ID = %v, %v", got, ok)
+	}
+}
+
+func TestGetCommentFindsDeepReplies(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	post, _ := e.CreatePost(user, "sub", "post")
+	other, _ := e.CreatePost(user, "sub", "other")
+	comment, _ := e.CommentPost(user, post, "top")
+	for depth := 1; depth <= 4; depth++ {
+		comment, _ = e.AddReplyToComment(user, comment, fmt.Sprintf("depth %d", depth))
+	}
+
+	if got, ok := e.GetComment(post.ID, comment.ID); !ok || got != comment {
+		t.Fatalf("GetComment(%d, %d) = %v, %v", post.ID, comment.ID, got, ok)
+	}
+	if _, ok := e.GetComment(other.ID, comment.ID); ok {
+		t.Fatal("found a comment under the wrong post")
+	}
+	if _, ok := e.GetComment(post.ID, comment.ID+1); ok {
+		t.Fatal("found a comment that does not exist")
+	}
+	if _, ok := e.GetComment(other.ID+1, comment.ID); ok {
+		t.Fatal("found a comment under a missing post")
+	}
+}
+
+func TestRestrictPostingRequiresMembership(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	member, _ := e.RegisterUser("member")
+	outsider, _ := e.RegisterUser("outsider")
+	sub := e.CreateSubReddit(mod, "sub")
+	e.JoinSubReddit(member, "sub")
+
+	if _, err := e.CreatePost(outsider, "sub", "open by default"); err != nil {
+		t.Fatalf("non-member in an open subreddit: %v", err)
+	}
+	sub.RestrictPosting = true
+	if _, err := e.CreatePost(member, "sub", "member post"); err != nil {
+		t.Fatalf("member: %v", err)
+	}
+	if _, err := e.CreatePost(outsider, "sub", "outsider post"); err != ErrNotMember {
+		t.Fatalf("non-member = %v, want ErrNotMember", err)
+	}
+	if err := e.LeaveSubReddit(mod, "sub"); err != nil {
+		t.Fatalf("LeaveSubReddit: %v", err)
+	}
+	if _, err := e.CreatePost(mod, "sub", "moderator post"); err != nil {
+		t.Fatalf("moderator: %v", err)
+	}
+}
+
+func TestMinKarmaToPost(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	veteran, _ := e.RegisterUser("veteran")
+	newcomer, _ := e.RegisterUser("newcomer")
+	e.CreateSubReddit(mod, "open")
+	strict := e.CreateSubReddit(mod, "strict")
+	earned, _ := e.CreatePost(veteran, "open", "earn some karma")
+	e.UpvotePost(newcomer, earned)
+	strict.MinKarmaToPost = 1
+
+	if _, err := e.CreatePost(newcomer, "strict", "too soon"); err != ErrInsufficientKarma {
+		t.Fatalf("low-karma user = %v, want ErrInsufficientKarma", err)
+	}
+	if _, err := e.CreatePost(veteran, "strict", "earned it"); err != nil {
+		t.Fatalf("user with enough karma: %v", err)
+	}
+	if mod.Karma >= strict.MinKarmaToPost {
+		t.Fatalf("moderator unexpectedly has %d karma", mod.Karma)
+	}
+	if _, err := e.CreatePost(mod, "strict", "moderator post"); err != nil {
+		t.Fatalf("moderator: %v", err)
+	}
+}
+
+func TestCrossPostKeepsProvenance(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "origin")
+	e.CreateSubReddit(user, "first")
+	e.CreateSubReddit(user, "second")
+	original, _ := e.CreatePost(user, "origin", "worth sharing")
+
+	for i, target := range []string{"first", "second"} {
+		crossPost, err := e.CrossPost(user, original, target)
+		if err != nil {
+			t.Fatalf("CrossPost to %s: %v", target, err)
+		}
+		if !crossPost.IsCrossPost || crossPost.IsRepost || crossPost.OriginalPostID != original.ID ||
+			crossPost.SubReddit != target || crossPost.Content != original.Content {
+			t.Fatalf("cross-post = %+v", crossPost)
+		}
+		if original.CrossPostCount != i+1 {
+			t.Fatalf("CrossPostCount = %d, want %d", original.CrossPostCount, i+1)
+		}
+	}
+	if _, err := e.CrossPost(user, original, "missing"); err != ErrSubRedditNotFound {
+		t.Fatalf("CrossPost to a missing subreddit = %v, want ErrSubRedditNotFound", err)
+	}
+	if original.CrossPostCount != 2 {
+		t.Fatalf("failed cross-post changed CrossPostCount to %d", original.CrossPostCount)
+	}
+}
+
+func TestBlockingFiltersFeedAndMessages(t *testing.T) {
+	e := NewEngine()
+	viewer, _ := e.RegisterUser("viewer")
+	troll, _ := e.RegisterUser("troll")
+	friend, _ := e.RegisterUser("friend")
+	e.CreateSubReddit(viewer, "sub")
+	e.JoinSubReddit(troll, "sub")
+	e.JoinSubReddit(friend, "sub")
+	trollPost, _ := e.CreatePost(troll, "sub", "bait")
+	friendPost, _ := e.CreatePost(friend, "sub", "hello")
+	e.SendDirectMessage(troll, viewer, "before the block")
+
+	e.BlockUser(viewer, troll)
+	if got, want := postIDs(e.GetUserFeedNew(viewer)), []int{friendPost.ID}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("feed with troll blocked = %v, want %v", got, want)
+	}
+	if got := e.RetrieveMessages(viewer); len(got) != 0 {
+		t.Fatalf("blocked sender's messages were delivered: %+v", got)
+	}
+	if err := e.SendDirectMessage(troll, viewer, "after the block"); err != ErrBlocked {
+		t.Fatalf("SendDirectMessage to a blocker = %v, want ErrBlocked", err)
+	}
+	if err := e.SendDirectMessage(viewer, troll, "one-way"); err != nil {
+		t.Fatalf("blocker messaging the blocked user: %v", err)
+	}
+	if got := len(e.GetUserFeed(troll)); got != 2 {
+		t.Fatalf("blocked user's own feed has %d posts, want 2", got)
+	}
+
+	e.UnblockUser(viewer, troll)
+	if got := postIDs(e.GetUserFeedNew(viewer)); fmt.Sprint(got) != fmt.Sprint([]int{friendPost.ID, trollPost.ID}) {
+		t.Fatalf("feed after unblocking = %v", got)
+	}
+	if got := e.RetrieveMessages(viewer); len(got) != 1 {
+		t.Fatalf("messages after unblocking = %+v, want the original one", got)
+	}
+}
+
+func TestConnectAndDisconnectAreIdempotent(t *testing.T) {
+	e := NewEngine()
+	alice, _ := e.RegisterUser("alice")
+	bob, _ := e.RegisterUser("bob")
+	if !alice.Connected || e.DisconnectedUsers.Load() != 0 {
+		t.Fatal("new users should start connected")
+	}
+
+	for _, step := range []struct {
+		name string
+		do   func()
+		want int64
+	}{
+		{"disconnect alice", func() { e.Disconnect(alice) }, 1},
+		{"disconnect alice again", func() { e.Disconnect(alice) }, 1},
+		{"disconnect bob", func() { e.Disconnect(bob) }, 2},
+		{"connect alice", func() { e.Connect(alice) }, 1},
+		{"connect alice again", func() { e.Connect(alice) }, 1},
+		{"connect bob", func() { e.Connect(bob) }, 0},
+		{"connect bob again", func() { e.Connect(bob) }, 0},
+	} {
+		step.do()
+		if got := e.DisconnectedUsers.Load(); got != step.want {
+			t.Fatalf("after %s: DisconnectedUsers = %d, want %d", step.name, got, step.want)
+		}
+	}
+	if !alice.Connected || !bob.Connected {
+		t.Fatal("users should be connected at the end")
+	}
+}
+
+func TestOfflineActionsReplayInOrderOnConnect(t *testing.T) {
+	e := NewEngine()
+	author, _ := e.RegisterUser("author")
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(author, "sub")
+	post, _ := e.CreatePost(author, "sub", "post")
+
+	e.Disconnect(user)
+	if got, err := e.CreatePost(user, "sub", "first"); err != ErrQueued || got != nil {
+		t.Fatalf("offline CreatePost = %v, %v; want nil, ErrQueued", got, err)
+	}
+	if _, err := e.CommentPost(user, post, "comment"); err != ErrQueued {
+		t.Fatalf("offline CommentPost = %v, want ErrQueued", err)
+	}
+	if err := e.UpvotePost(user, post); err != ErrQueued {
+		t.Fatalf("offline UpvotePost = %v, want ErrQueued", err)
+	}
+	e.DownvotePost(user, post)
+	e.CreatePost(user, "sub", "second")
+	if post.Score() != 0 || len(post.Comments) != 0 || len(e.GetUserPosts(user.ID)) != 0 {
+		t.Fatal("queued actions ran while the user was offline")
+	}
+
+	start := len(e.ActivityLog)
+	e.Connect(user)
+	var replayed []ActivityType
+	for _, event := range e.ActivityLog[start:] {
+		replayed = append(replayed, event.Type)
+	}
+	want := []ActivityType{ActivityConnect, ActivityPost, ActivityComment, ActivityVote, ActivityVote, ActivityPost}
+	if fmt.Sprint(replayed) != fmt.Sprint(want) {
+		t.Fatalf("replayed %v, want %v", replayed, want)
+	}
+	if post.Score() != -1 || post.Voters[user.ID] != -1 {
+		t.Fatalf("score after replay = %d; the later downvote should win", post.Score())
+	}
+	if len(post.Comments) != 1 || post.Comments[0].Content != "comment" {
+		t.Fatal("queued comment was not applied")
+	}
+	var contents []string
+	for _, p := range e.GetUserPosts(user.ID) {
+		contents = append(contents, p.Content)
+	}
+	if fmt.Sprint(contents) != "[second first]" {
+		t.Fatalf("user's posts newest first = %v", contents)
+	}
+
+	e.Disconnect(user)
+	e.Connect(user)
+	if post.Score() != -1 || len(e.GetUserPosts(user.ID)) != 2 {
+		t.Fatal("queue was replayed more than once")
+	}
+}
+
+func TestSubscriberAndPostCounts(t *testing.T) {
+	e := NewEngine()
+	creator, _ := e.RegisterUser("creator")
+	e.CreateSubReddit(creator, "sub")
+	base, _ := e.SubscriberCount("sub")
+	for i := 0; i < 3; i++ {
+		user, _ := e.RegisterUser(fmt.Sprintf("user%d", i))
+		e.JoinSubReddit(user, "sub")
+		e.CreatePost(user, "sub", fmt.Sprintf("post %d", i))
+	}
+	leaver, _ := e.GetUserByName("user0")
+	e.LeaveSubReddit(leaver, "sub")
+
+	if got, err := e.SubscriberCount("sub"); err != nil || got != base+2 {
+		t.Fatalf("SubscriberCount = %d, %v; want %d", got, err, base+2)
+	}
+	if got, err := e.PostCount("SUB"); err != nil || got != 3 {
+		t.Fatalf("PostCount = %d, %v; want 3", got, err)
+	}
+	if _, err := e.SubscriberCount("missing"); err != ErrSubRedditNotFound {
+		t.Fatalf("SubscriberCount(missing) = %v, want ErrSubRedditNotFound", err)
+	}
+	if _, err := e.PostCount("missing"); err != ErrSubRedditNotFound {
+		t.Fatalf("PostCount(missing) = %v, want ErrSubRedditNotFound", err)
+	}
+}
+
+func TestMaxCommentDepth(t *testing.T) {
+	e := NewEngine()
+	e.MaxCommentDepth = 3
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	post, _ := e.CreatePost(user, "sub", "post")
+	root, _ := e.CommentPost(user, post, "root")
+
+	parent := root
+	for depth := 1; depth <= 3; depth++ {
+		reply, err := e.AddReplyToComment(user, parent, fmt.Sprintf("depth %d", depth))
+		if err != nil {
+			t.Fatalf("reply at depth %d: %v", depth, err)
+		}
+		parent = reply
+	}
+	if _, err := e.AddReplyToComment(user, parent, "too deep"); err != ErrMaxDepthExceeded {
+		t.Fatalf("reply at depth 4 = %v, want ErrMaxDepthExceeded", err)
+	}
+	if _, err := e.AddReply(user, post.ID, parent.ID, "too deep"); err != ErrMaxDepthExceeded {
+		t.Fatalf("AddReply at depth 4 = %v, want ErrMaxDepthExceeded", err)
+	}
+	if _, err := e.AddReply(user, post.ID, root.ID, "shallow sibling"); err != nil {
+		t.Fatalf("AddReply at depth 1: %v", err)
+	}
+	if len(parent.Replies) != 0 {
+		t.Fatal("rejected replies were attached")
+	}
+
+	e.MaxCommentDepth = 0
+	if _, err := e.AddReplyToComment(user, parent, "unlimited"); err != nil {
+		t.Fatalf("reply with no depth limit: %v", err)
+	}
+}
+
+func TestContentLengthLimits(t *testing.T) {
+	e := NewEngine()
+	e.MaxPostLength = 10
+	e.MaxCommentLength = 5
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+
+	for _, tc := range []struct {
+		content string
+		want    error
+	}{
+		{"", ErrEmptyContent},
+		{"   \n", ErrEmptyContent},
+		{strings.Repeat("é", 10), nil},
+		{strings.Repeat("x", 11), ErrContentTooLong},
+	} {
+		if _, err := e.CreatePost(user, "sub", tc.content); err != tc.want {
+			t.Errorf("CreatePost(%q) = %v, want %v", tc.content, err, tc.want)
+		}
+	}
+	post, _ := e.CreatePost(user, "sub", "ok")
+	for _, tc := range []struct {
+		content string
+		want    error
+	}{
+		{"", ErrEmptyContent},
+		{"12345", nil},
+		{"123456", ErrContentTooLong},
+	} {
+		if _, err := e.CommentPost(user, post, tc.content); err != tc.want {
+			t.Errorf("CommentPost(%q) = %v, want %v", tc.content, err, tc.want)
+		}
+	}
+	comment := post.Comments[0]
+	if _, err := e.AddReplyToComment(user, comment, "123456"); err != ErrContentTooLong {
+		t.Errorf("over-length reply = %v, want ErrContentTooLong", err)
+	}
+	if _, err := e.AddReplyToComment(user, comment, ""); err != ErrEmptyContent {
+		t.Errorf("empty reply = %v, want ErrEmptyContent", err)
+	}
+
+	if d := NewEngine(); d.MaxPostLength != DefaultMaxPostLength || d.MaxCommentLength != DefaultMaxCommentLength {
+		t.Fatalf("defaults = %d, %d", d.MaxPostLength, d.MaxCommentLength)
+	}
+}
+
+func TestSubRedditNamesIgnoreCase(t *testing.T) {
+	e := NewEngine()
+	creator, _ := e.RegisterUser("creator")
+	user, _ := e.RegisterUser("user")
+	news := e.CreateSubReddit(creator, "News")
+	if dup := e.CreateSubReddit(creator, "NEWS"); dup != nil {
+		t.Fatalf("case-variant duplicate was created: %+v", dup)
+	}
+	if news.DisplayName != "News" || len(e.SubReddits) != 1 {
+		t.Fatalf("DisplayName = %q with %d subreddits", news.DisplayName, len(e.SubReddits))
+	}
+
+	if err := e.JoinSubReddit(user, "news"); err != nil {
+		t.Fatalf("JoinSubReddit(news): %v", err)
+	}
+	if err := e.JoinSubReddit(user, "NEWS"); err != ErrAlreadyMember {
+		t.Fatalf("JoinSubReddit(NEWS) = %v, want ErrAlreadyMember", err)
+	}
+	post, err := e.CreatePost(user, "nEwS", "headline")
+	if err != nil {
+		t.Fatalf("CreatePost: %v", err)
+	}
+	if found, ok := e.GetSubReddit("NeWs"); !ok || found != news || len(found.Posts) != 1 || found.Posts[0] != post {
+		t.Fatal("lookups by another case missed the community")
+	}
+}
+
+func TestRegisterUserRejectsTakenNames(t *testing.T) {
+	e := NewEngine()
+	alice, err := e.RegisterUser("Alice")
+	if err != nil {
+		t.Fatalf("RegisterUser: %v", err)
+	}
+	for _, name := range []string{"Alice", "alice", "ALICE"} {
+		if user, err := e.RegisterUser(name); err != ErrUsernameTaken || user != nil {
+			t.Fatalf("RegisterUser(%q) = %v, %v; want ErrUsernameTaken", name, user, err)
+		}
+	}
+	if len(e.Users) != 1 {
+		t.Fatalf("%d users registered, want 1", len(e.Users))
+	}
+
+	if got, ok := e.GetUserByName("aLiCe"); !ok || got != alice {
+		t.Fatalf("GetUserByName = %v, %v", got, ok)
+	}
+	if _, ok := e.GetUserByName("bob"); ok {
+		t.Fatal("found an unregistered user")
+	}
+	e.DeleteUser(alice.ID)
+	if _, ok := e.GetUserByName("alice"); ok {
+		t.Fatal("deleted user is still indexed by name")
+	}
+	if _, err := e.RegisterUser("alice"); err != nil {
+		t.Fatalf("reusing a deleted user's name: %v", err)
+	}
+}
+
+func TestVoteWeightFnScalesScoreAndKarma(t *testing.T) {
+	e, author, voter, post := newVoteFixture(t)
+	light, _ := e.RegisterUser("light")
+	voter.Karma = 20
+	e.VoteWeightFn = func(v *User) int { return 1 + v.Karma/10 }
+	karma := author.Karma
+
+	e.UpvotePost(voter, post)
+	if post.Score() != 3 || author.Karma != karma+3 {
+		t.Fatalf("after a weight-3 upvote: score %d, karma %d", post.Score(), author.Karma-karma)
+	}
+	e.DownvotePost(light, post)
+	if post.Score() != 2 || post.Upvotes != 3 || post.Downvotes != 1 || author.Karma != karma+2 {
+		t.Fatalf("after a weight-1 downvote: score %d (%d/%d), karma %d", post.Score(), post.Upvotes, post.Downvotes, author.Karma-karma)
+	}
+	e.DownvotePost(voter, post)
+	if post.Score() != -4 || author.Karma != karma-4 {
+		t.Fatalf("after switching the weighted vote: score %d, karma %d", post.Score(), author.Karma-karma)
+	}
+	e.RemoveVote(voter, post)
+	if post.Score() != -1 || author.Karma != karma-1 {
+		t.Fatalf("after removing the weighted vote: score %d, karma %d", post.Score(), author.Karma-karma)
+	}
+
+	e.VoteWeightFn = nil
+	e.UpvotePost(voter, post)
+	if post.Score() != 0 {
+		t.Fatalf("default weight should be 1, score %d", post.Score())
+	}
+}
+
+func TestSubRedditKarmaIsPerCommunity(t *testing.T) {
+	e := NewEngine()
+	author, _ := e.RegisterUser("author")
+	voter, _ := e.RegisterUser("voter")
+	e.CreateSubReddit(author, "SubReddit1")
+	e.CreateSubReddit(author, "SubReddit2")
+	post, _ := e.CreatePost(author, "SubReddit1", "post")
+	comment, _ := e.CommentPost(voter, post, "comment")
+	elsewhere, _ := e.CreatePost(author, "SubReddit2", "elsewhere")
+
+	e.UpvotePost(voter, post)
+	if got := e.GetSubRedditKarma(author, "subreddit1"); got != 1 {
+		t.Fatalf("SubReddit1 karma = %d, want 1", got)
+	}
+	if got := e.GetSubRedditKarma(author, "SubReddit2"); got != 0 {
+		t.Fatalf("SubReddit2 karma = %d, want 0", got)
+	}
+	e.UpvoteComment(comment)
+	if got := e.GetSubRedditKarma(voter, "SubReddit1"); got != 1 {
+		t.Fatalf("commenter's SubReddit1 karma = %d, want 1", got)
+	}
+	e.DownvotePost(voter, elsewhere)
+	if got := e.GetSubRedditKarma(author, "SubReddit2"); got != -1 {
+		t.Fatalf("SubReddit2 karma after a downvote = %d, want -1", got)
+	}
+	if got := e.GetSubRedditKarma(author, "SubReddit1"); got != 1 {
+		t.Fatalf("SubReddit1 karma changed to %d", got)
+	}
+}
+
+func TestJoiningTwiceCountsOnce(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	sub := e.CreateSubReddit(nil, "sub")
+	actions := e.TotalActions.Load()
+
+	if err := e.JoinSubReddit(user, "sub"); err != nil {
+		t.Fatalf("first join: %v", err)
+	}
+	if err := e.JoinSubReddit(user, "sub"); err != ErrAlreadyMember {
+		t.Fatalf("second join = %v, want ErrAlreadyMember", err)
+	}
+	if len(sub.Users) != 1 {
+		t.Fatalf("membership size = %d, want 1", len(sub.Users))
+	}
+	if got := e.TotalActions.Load() - actions; got != 1 {
+		t.Fatalf("TotalActions grew by %d, want 1", got)
+	}
+	if got := user.Actions.Load(); got != 1 {
+		t.Fatalf("user actions = %d, want 1", got)
+	}
+}
+
+func TestLeavingRequiresMembership(t *testing.T) {
+	e := NewEngine()
+	member, _ := e.RegisterUser("member")
+	outsider, _ := e.RegisterUser("outsider")
+	sub := e.CreateSubReddit(nil, "sub")
+	e.JoinSubReddit(member, "sub")
+	actions := e.TotalActions.Load()
+
+	if err := e.LeaveSubReddit(outsider, "sub"); err != ErrNotMember {
+		t.Fatalf("leaving without membership = %v, want ErrNotMember", err)
+	}
+	if e.TotalActions.Load() != actions || outsider.Actions.Load() != 0 {
+		t.Fatal("a failed leave counted an action")
+	}
+	if err := e.LeaveSubReddit(member, "sub"); err != nil {
+		t.Fatalf("member leaving: %v", err)
+	}
+	if _, still := sub.Users[member.ID]; still || e.TotalActions.Load() != actions+1 {
+		t.Fatal("member leave was not applied or not counted")
+	}
+	if err := e.LeaveSubReddit(member, "missing"); err != ErrSubRedditNotFound {
+		t.Fatalf("leaving a missing subreddit = %v, want ErrSubRedditNotFound", err)
+	}
+}
+
+func TestRegisterUsersRejectsWholeBatch(t *testing.T) {
+	e := NewEngine()
+	e.RegisterUser("taken")
+
+	for _, batch := range [][]string{{"a", "b", "TAKEN"}, {"c", "d", "C"}} {
+		if users, err := e.RegisterUsers(batch); err != ErrUsernameTaken || users != nil {
+			t.Fatalf("RegisterUsers(%v) = %v, %v; want ErrUsernameTaken", batch, users, err)
+		}
+	}
+	if len(e.Users) != 1 {
+		t.Fatalf("%d users after rejected batches, want 1", len(e.Users))
+	}
+	users, err := e.RegisterUsers([]string{"a", "b"})
+	if err != nil || len(users) != 2 || users[0].Username != "a" || users[1].ID <= users[0].ID {
+		t.Fatalf("RegisterUsers = %v, %v", users, err)
+	}
+}
+
+func batchNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("user%d", i)
+	}
+	return names
+}
+
+func BenchmarkRegisterUsersBatch(b *testing.B) {
+	names := batchNames(1000)
+	for i := 0; i < b.N; i++ {
+		e := NewEngine()
+		if _, err := e.RegisterUsers(names); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRegisterUsersOneByOne(b *testing.B) {
+	names := batchNames(1000)
+	for i := 0; i < b.N; i++ {
+		e := NewEngine()
+		for _, name := range names {
+			if _, err := e.RegisterUser(name); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestSnapshotsAreSafeDuringRegistration(t *testing.T) {
+	e := NewEngine()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				user, _ := e.RegisterUser(fmt.Sprintf("user%d-%d", w, i))
+				e.CreateSubReddit(user, fmt.Sprintf("sub%d-%d", w, i))
+			}
+		}(w)
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				for _, user := range e.SnapshotUsers() {
+					_ = user.Username
+				}
+				for _, subReddit := range e.SnapshotSubReddits() {
+					_ = subReddit.DisplayName
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(e.SnapshotUsers()); got != 200 {
+		t.Fatalf("SnapshotUsers has %d users, want 200", got)
+	}
+	if got := len(e.SnapshotSubReddits()); got != 200 {
+		t.Fatalf("SnapshotSubReddits has %d subreddits, want 200", got)
+	}
+}
+
+func TestDeleteMessageBySenderOrRecipient(t *testing.T) {
+	e := NewEngine()
+	alice, _ := e.RegisterUser("alice")
+	bob, _ := e.RegisterUser("bob")
+	eve, _ := e.RegisterUser("eve")
+	e.SendDirectMessage(alice, bob, "one")
+	e.SendDirectMessage(alice, bob, "two")
+	e.SendDirectMessage(alice, bob, "three")
+	inbox := e.RetrieveMessages(bob)
+
+	if err := e.DeleteMessage(eve, &inbox[0]); err != ErrNotAuthorized {
+		t.Fatalf("DeleteMessage by a third party = %v, want ErrNotAuthorized", err)
+	}
+	if err := e.DeleteMessage(alice, &inbox[0]); err != nil {
+		t.Fatalf("DeleteMessage by the sender: %v", err)
+	}
+	if err := e.DeleteMessage(bob, &inbox[2]); err != nil {
+		t.Fatalf("DeleteMessage by the recipient: %v", err)
+	}
+	remaining := e.RetrieveMessages(bob)
+	if len(remaining) != 1 || remaining[0].ID != inbox[1].ID {
+		t.Fatalf("remaining messages = %+v, want only %q", remaining, "two")
+	}
+	if err := e.DeleteMessage(bob, &inbox[0]); err != ErrMessageNotFound {
+		t.Fatalf("deleting twice = %v, want ErrMessageNotFound", err)
+	}
+}
+
+func TestMessageIDsAreUniqueAndIncreasing(t *testing.T) {
+	e := NewEngine()
+	alice, _ := e.RegisterUser("alice")
+	bob, _ := e.RegisterUser("bob")
+	for i := 0; i < 5; i++ {
+		e.SendDirectMessage(alice, bob, fmt.Sprintf("to bob %d", i))
+		e.SendDirectMessage(bob, alice, fmt.Sprintf("to alice %d", i))
+	}
+
+	seen := make(map[int]bool)
+	last := -1
+	for _, message := range e.GetConversation(alice, bob) {
+		if seen[message.ID] {
+			t.Fatalf("message ID %d reused", message.ID)
+		}
+		if message.ID <= last {
+			t.Fatalf("message ID %d follows %d", message.ID, last)
+		}
+		seen[message.ID] = true
+		last = message.ID
+	}
+	if len(seen) != 10 {
+		t.Fatalf("%d distinct IDs, want 10", len(seen))
+	}
+	for _, message := range e.RetrieveMessages(bob) {
+		if !seen[message.ID] {
+			t.Fatalf("RetrieveMessages exposed unknown ID %d", message.ID)
+		}
+	}
+}
+
+// newBatchFixture registers voters and posts and a deterministic mix of votes
+// over them, including repeats and switches.
+func newBatchFixture(tb testing.TB, numVoters, numPosts int) (*Engine, []VoteOp) {
+	tb.Helper()
+	e := NewEngine()
+	author, _ := e.RegisterUser("author")
+	e.CreateSubReddit(author, "sub")
+	posts := make([]*Post, numPosts)
+	for i := range posts {
+		posts[i], _ = e.CreatePost(author, "sub", fmt.Sprintf("post %d", i))
+	}
+	var votes []VoteOp
+	for v := 0; v < numVoters; v++ {
+		voter, _ := e.RegisterUser(fmt.Sprintf("voter%d", v))
+		for p, post := range posts {
+			direction := 1
+			if (v+p)%3 == 0 {
+				direction = -1
+			}
+			votes = append(votes, VoteOp{User: voter, Post: post, Direction: direction})
+			if (v*p)%5 == 0 {
+				votes = append(votes, VoteOp{User: voter, Post: post, Direction: -direction})
+			}
+		}
+	}
+	return e, votes
+}
+
+func applyVotesIndividually(e *Engine, votes []VoteOp) {
+	for _, op := range votes {
+		if op.Direction > 0 {
+			e.UpvotePost(op.User, op.Post)
+		} else {
+			e.DownvotePost(op.User, op.Post)
+		}
+	}
+}
+
+func TestBatchVoteMatchesIndividualVotes(t *testing.T) {
+	batched, batchOps := newBatchFixture(t, 20, 5)
+	single, singleOps := newBatchFixture(t, 20, 5)
+	batched.BatchVote(append(batchOps, VoteOp{User: batchOps[0].User, Post: batchOps[0].Post}))
+	applyVotesIndividually(single, singleOps)
+
+	for i := range batchOps {
+		b, s := batchOps[i].Post, singleOps[i].Post
+		if b.Score() != s.Score() || b.Upvotes != s.Upvotes || b.Downvotes != s.Downvotes {
+			t.Fatalf("post %d: batched %d/%d, individual %d/%d", b.ID, b.Upvotes, b.Downvotes, s.Upvotes, s.Downvotes)
+		}
+	}
+	if b, s := batched.Metrics(), single.Metrics(); b.TotalVotes != s.TotalVotes ||
+		b.TotalUpvotes != s.TotalUpvotes || b.TotalDownvotes != s.TotalDownvotes || b.TotalActions != s.TotalActions {
+		t.Fatalf("counters differ:\nbatched    %+v\nindividual %+v", b, s)
+	}
+	ba, _ := batched.GetUserByName("author")
+	sa, _ := single.GetUserByName("author")
+	if ba.Karma != sa.Karma {
+		t.Fatalf("author karma: batched %d, individual %d", ba.Karma, sa.Karma)
+	}
+}
+
+func BenchmarkBatchVote(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		e, votes := newBatchFixture(b, 50, 20)
+		b.StartTimer()
+		e.BatchVote(votes)
+	}
+}
+
+func BenchmarkIndividualVotes(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		e, votes := newBatchFixture(b, 50, 20)
+		b.StartTimer()
+		applyVotesIndividually(e, votes)
+	}
+}
+
+func TestGetSubRedditMembersPages(t *testing.T) {
+	e := NewEngine()
+	e.CreateSubReddit(nil, "sub")
+	users, _ := e.RegisterUsers([]string{"a", "b", "c", "d", "e"})
+	for i := len(users) - 1; i >= 0; i-- {
+		e.JoinSubReddit(users[i], "sub")
+	}
+	ids := func(members []*User) []int {
+		out := make([]int, len(members))
+		for i, member := range members {
+			out[i] = member.ID
+		}
+		return out
+	}
+
+	for _, tc := range []struct {
+		offset, limit int
+		want          []*User
+	}{
+		{0, 0, users},
+		{0, 2, users[:2]},
+		{2, 2, users[2:4]},
+		{4, 2, users[4:]},
+		{-3, 1, users[:1]},
+		{10, 2, nil},
+	} {
+		page, err := e.GetSubRedditMembers("sub", tc.offset, tc.limit)
+		if err != nil {
+			t.Fatalf("GetSubRedditMembers(%d, %d): %v", tc.offset, tc.limit, err)
+		}
+		if got, want := ids(page), ids(tc.want); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("page (%d, %d) = %v, want %v", tc.offset, tc.limit, got, want)
+		}
+	}
+	if _, err := e.GetSubRedditMembers("missing", 0, 10); err != ErrSubRedditNotFound {
+		t.Fatalf("GetSubRedditMembers(missing) = %v, want ErrSubRedditNotFound", err)
+	}
+}
+
+func TestDetectDuplicates(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	e.CreateSubReddit(user, "other")
+	original, _ := e.CreatePost(user, "sub", "same words")
+	if _, err := e.CreatePost(user, "sub", "same words"); err != nil {
+		t.Fatalf("duplicate with detection off: %v", err)
+	}
+
+	e.DetectDuplicates = true
+	if post, err := e.CreatePost(user, "sub", "same words"); err != ErrDuplicatePost || post != nil {
+		t.Fatalf("exact duplicate = %v, %v; want ErrDuplicatePost", post, err)
+	}
+	if _, err := e.CreatePost(user, "sub", "Same words"); err != nil {
+		t.Fatalf("distinct post: %v", err)
+	}
+	if _, err := e.CreatePost(user, "other", "same words"); err != nil {
+		t.Fatalf("same content in another subreddit: %v", err)
+	}
+	if repost := e.CreateRepost(user, original, "sub"); repost == nil {
+		t.Fatal("repost was rejected as a duplicate")
+	}
+}
+
+func TestUserCreatedAtUsesEngineClock(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	first, _ := e.RegisterUser("first")
+	*now = testEpoch.Add(36 * time.Hour)
+	second, _ := e.RegisterUser("second")
+	batch, _ := e.RegisterUsers([]string{"third"})
+
+	if !first.CreatedAt.Equal(testEpoch) {
+		t.Fatalf("first CreatedAt = %v, want %v", first.CreatedAt, testEpoch)
+	}
+	if want := testEpoch.Add(36 * time.Hour); !second.CreatedAt.Equal(want) || !batch[0].CreatedAt.Equal(want) {
+		t.Fatalf("later CreatedAt = %v and %v, want %v", second.CreatedAt, batch[0].CreatedAt, want)
+	}
+}
+
+func TestLeaveAllSubReddits(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	other, _ := e.RegisterUser("other")
+	for _, name := range []string{"a", "b", "c", "d"} {
+		e.CreateSubReddit(other, name)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		e.JoinSubReddit(user, name)
+	}
+	actions, userActions := e.TotalActions.Load(), user.Actions.Load()
+
+	if left := e.LeaveAllSubReddits(user); left != 3 {
+		t.Fatalf("LeaveAllSubReddits = %d, want 3", left)
+	}
+	for _, sub := range e.SnapshotSubReddits() {
+		if _, member := sub.Users[user.ID]; member {
+			t.Fatalf("user is still a member of %s", sub.Name)
+		}
+		if _, member := sub.Users[other.ID]; !member {
+			t.Fatalf("other user was removed from %s", sub.Name)
+		}
+	}
+	if e.TotalActions.Load()-actions != 3 || user.Actions.Load()-userActions != 3 {
+		t.Fatal("each departure should count as one action, as with LeaveSubReddit")
+	}
+	if left := e.LeaveAllSubReddits(user); left != 0 || e.TotalActions.Load()-actions != 3 {
+		t.Fatalf("second LeaveAllSubReddits left %d", left)
+	}
+}
+
+func TestCanCreatePostMatchesCreatePost(t *testing.T) {
+	e := NewEngine()
+	setClock(e, testEpoch)
+	e.MaxPostLength = 20
+	e.DetectDuplicates = true
+	e.RateLimit = RateLimit{Actions: 1, Window: time.Hour}
+	mod, _ := e.RegisterUser("mod")
+	member, _ := e.RegisterUser("member")
+	outsider, _ := e.RegisterUser("outsider")
+	banned, _ := e.RegisterUser("banned")
+	offline, _ := e.RegisterUser("offline")
+	limited, _ := e.RegisterUser("limited")
+	e.CreateSubReddit(mod, "open")
+	e.CreateSubReddit(mod, "members").RestrictPosting = true
+	e.CreateSubReddit(mod, "veterans").MinKarmaToPost = 10
+	e.JoinSubReddit(member, "members")
+	e.BanUser(mod, banned, "open")
+	e.Disconnect(offline)
+	e.CreatePost(limited, "open", "taken")
+
+	for _, tc := range []struct {
+		name      string
+		user      *User
+		subReddit string
+		content   string
+		want      error
+	}{
+		{"empty content", member, "open", " ", ErrEmptyContent},
+		{"too long", member, "open", "this post is far too long", ErrContentTooLong},
+		{"offline", offline, "open", "hello", ErrQueued},
+		{"missing subreddit", member, "missing", "hello", ErrSubRedditNotFound},
+		{"banned", banned, "open", "hello", ErrBanned},
+		{"not a member", outsider, "members", "hello", ErrNotMember},
+		{"not enough karma", member, "veterans", "hello", ErrInsufficientKarma},
+		{"duplicate", member, "open", "taken", ErrDuplicatePost},
+		{"rate limited", limited, "open", "hello", ErrRateLimited},
+		{"allowed", member, "members", "hello", nil},
+	} {
+		posts := e.TotalPosts.Load()
+		if err := e.CanCreatePost(tc.user, tc.subReddit, tc.content); err != tc.want {
+			t.Errorf("%s: CanCreatePost = %v, want %v", tc.name, err, tc.want)
+		}
+		if err := e.CanCreatePost(tc.user, tc.subReddit, tc.content); err != tc.want {
+			t.Errorf("%s: second CanCreatePost = %v; the check must not spend anything", tc.name, err)
+		}
+		if e.TotalPosts.Load() != posts {
+			t.Fatalf("%s: CanCreatePost created a post", tc.name)
+		}
+		if tc.want == ErrQueued {
+			continue
+		}
+		if _, err := e.CreatePost(tc.user, tc.subReddit, tc.content); err != tc.want {
+			t.Errorf("%s: CreatePost = %v, but CanCreatePost said %v", tc.name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// hotEpoch is the reference point Reddit's hot formula measures post age from.
+var hotEpoch = time.Unix(1134028003, 0)
+
+// hotScore ranks a post by the log of its net votes plus a bonus for recency,
+// so every 12.5 hours of age is worth a tenfold difference in votes.
+func hotScore(post *Post) float64 {
+	score := post.Score()
+	order := math.Log10(math.Max(math.Abs(float64(score)), 1))
+	sign := 0.0
+	if score > 0 {
+		sign = 1
+	} else if score < 0 {
+		sign = -1
+	}
+	seconds := post.CreatedAt.Sub(hotEpoch).Seconds()
+	return sign*order + seconds/45000
+}
+
+// controversyScore favours posts with many votes split close to evenly; a post
+// with votes in only one direction isn't controversial at all.
+func controversyScore(post *Post) float64 {
+	if post.Upvotes <= 0 || post.Downvotes <= 0 {
+		return 0
+	}
+	magnitude := float64(post.Upvotes + post.Downvotes)
+	balance := float64(min(post.Upvotes, post.Downvotes)) / float64(max(post.Upvotes, post.Downvotes))
+	return math.Pow(magnitude, balance)
+}
+
+func sortHot(posts []*Post) {
+	sort.SliceStable(posts, func(i, j int) bool {
+		si, sj := hotScore(posts[i]), hotScore(posts[j])
+		if si != sj {
+			return si > sj
+		}
+		return posts[i].ID > posts[j].ID
+	})
+}
+
+func sortNew(posts []*Post) {
+	sort.SliceStable(posts, func(i, j int) bool {
+		if !posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].CreatedAt.After(posts[j].CreatedAt)
+		}
+		return posts[i].ID > posts[j].ID
+	})
+}
+
+func sortTop(posts []*Post) {
+	sort.SliceStable(posts, func(i, j int) bool {
+		if si, sj := posts[i].Score(), posts[j].Score(); si != sj {
+			return si > sj
+		}
+		if !posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].CreatedAt.After(posts[j].CreatedAt)
+		}
+		return posts[i].ID > posts[j].ID
+	})
+}
+
+func sortControversial(posts []*Post) {
+	sort.SliceStable(posts, func(i, j int) bool {
+		si, sj := controversyScore(posts[i]), controversyScore(posts[j])
+		if si != sj {
+			return si > sj
+		}
+		return posts[i].ID > posts[j].ID
+	})
+}
+
+// sortPosts orders posts by the named mode, falling back to hot for
+// anything other than "new" or "top".
+func sortPosts(posts []*Post, mode string) {
+	switch mode {
+	case "new":
+		sortNew(posts)
+	case "top":
+		sortTop(posts)
+	default:
+		sortHot(posts)
+	}
+}
+
+// visibleTo reports whether post belongs in user's feed: its author isn't
+// blocked, and it isn't NSFW unless the user has opted in.
+func visibleTo(post *Post, user *User) bool {
+	return !user.Blocked[post.Author.ID] && (!post.NSFW || user.ShowNSFW)
+}
+
+// subscribedPosts collects every post in the subreddits user has joined that
+// is visible to them. Callers must hold e.Mutex.
+func (e *Engine) subscribedPosts(user *User) []*Post {
+	feed, _ := e.subscribedPostsContext(context.Background(), user)
+	return feed
+}
+
+// subscribedPostsContext is subscribedPosts, checking ctx before each
+// subreddit is scanned. Callers must hold e.Mutex.
+func (e *Engine) subscribedPostsContext(ctx context.Context, user *User) ([]*Post, error) {
+	var feed []*Post
+	for _, subreddit := range e.SubReddits {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		subreddit.Mutex.RLock()
+		if _, subscribed := subreddit.Users[user.ID]; subscribed {
+			for _, post := range subreddit.Posts {
+				if visibleTo(post, user) {
+					feed = append(feed, post)
+				}
+			}
+		}
+		subreddit.Mutex.RUnlock()
+	}
+	return feed, nil
+}
+
+// limitFeed truncates an already ranked feed to FeedLimit posts, if set.
+func (e *Engine) limitFeed(feed []*Post) []*Post {
+	if e.FeedLimit > 0 && len(feed) > e.FeedLimit {
+		return feed[:e.FeedLimit]
+	}
+	return feed
+}
+
+func (e *Engine) GetUserFeed(user *User) []*Post {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	feed := e.subscribedPosts(user)
+	sortHot(feed)
+	return e.limitFeed(feed)
+}
+
+// GetUserFeedContext is GetUserFeed, abandoning the scan with ctx.Err() once
+// ctx is done.
+func (e *Engine) GetUserFeedContext(ctx context.Context, user *User) ([]*Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	feed, err := e.subscribedPostsContext(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	sortHot(feed)
+	return e.limitFeed(feed), nil
+}
+
+// discoveryWindow is how far back GetUserFeedWithDiscovery looks when picking
+// trending subreddits to backfill from.
+const discoveryWindow = 24 * time.Hour
+
+// GetUserFeedWithDiscovery returns the user's hot feed and, if it has fewer
+// than fillTo posts, tops it up with the best posts from trending subreddits
+// the user hasn't joined. Like GetUserFeed, the result is capped at FeedLimit.
+func (e *Engine) GetUserFeedWithDiscovery(user *User, fillTo int) []*Post {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	feed := e.subscribedPosts(user)
+	sortHot(feed)
+	if len(feed) >= fillTo {
+		return e.limitFeed(feed)
+	}
+	seen := make(map[int]bool, len(feed))
+	for _, post := range feed {
+		seen[post.ID] = true
+	}
+	for _, trending := range e.trendingSubReddits(0, discoveryWindow) {
+		subReddit := e.SubReddits[subRedditKey(trending.Name)]
+		subReddit.Mutex.RLock()
+		_, joined := subReddit.Users[user.ID]
+		candidates := append([]*Post{}, subReddit.Posts...)
+		subReddit.Mutex.RUnlock()
+		if joined {
+			continue
+		}
+		sortTop(candidates)
+		for _, post := range candidates {
+			if len(feed) >= fillTo {
+				return e.limitFeed(feed)
+			}
+			if !seen[post.ID] && visibleTo(post, user) {
+				seen[post.ID] = true
+				feed = append(feed, post)
+			}
+		}
+	}
+	return feed
+}
+
+// GetFeeds builds the hot feed of every user in users, keyed by user ID, in a
+// single pass over the subreddits. A user listed more than once gets one feed.
+func (e *Engine) GetFeeds(users []*User) map[int][]*Post {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	feeds := make(map[int][]*Post, len(users))
+	distinct := make([]*User, 0, len(users))
+	for _, user := range users {
+		if _, seen := feeds[user.ID]; !seen {
+			feeds[user.ID] = nil
+			distinct = append(distinct, user)
+		}
+	}
+	for _, subreddit := range e.SubReddits {
+		subreddit.Mutex.RLock()
+		for _, user := range distinct {
+			if _, subscribed := subreddit.Users[user.ID]; !subscribed {
+				continue
+			}
+			for _, post := range subreddit.Posts {
+				if visibleTo(post, user) {
+					feeds[user.ID] = append(feeds[user.ID], post)
+				}
+			}
+		}
+		subreddit.Mutex.RUnlock()
+	}
+	for id, feed := range feeds {
+		sortHot(feed)
+		feeds[id] = e.limitFeed(feed)
+	}
+	return feeds
+}
+
+func (e *Engine) GetUserFeedNew(user *User) []*Post {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	feed := e.subscribedPosts(user)
+	sortNew(feed)
+	return e.limitFeed(feed)
+}
+
+func (e *Engine) GetControversial(user *User) []*Post {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	feed := e.subscribedPosts(user)
+	sortControversial(feed)
+	return e.limitFeed(feed)
+}
+
+// GetSubRedditFeed lists the subreddit's posts sorted by mode, with pinned
+// posts ahead of everything else.
+func (e *Engine) GetSubRedditFeed(name, mode string) ([]*Post, error) {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	subReddit, exists := e.SubReddits[subRedditKey(name)]
+	if !exists {
+		return nil, ErrSubRedditNotFound
+	}
+	subReddit.Mutex.RLock()
+	feed := append([]*Post{}, subReddit.Posts...)
+	subReddit.Mutex.RUnlock()
+	sortPosts(feed, mode)
+	sort.SliceStable(feed, func(i, j int) bool {
+		return feed[i].Pinned && !feed[j].Pinned
+	})
+	return feed, nil
+}
+
+// GetUserFeedTop ranks subscribed posts by score, keeping only those created
+// within since. A non-positive since covers all time.
+func (e *Engine) GetUserFeedTop(user *User, since time.Duration) []*Post {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	feed := e.subscribedPosts(user)
+	if since > 0 {
+		cutoff := e.now().Add(-since)
+		recent := feed[:0]
+		for _, post := range feed {
+			if !post.CreatedAt.Before(cutoff) {
+				recent = append(recent, post)
+			}
+		}
+		feed = recent
+	}
+	sortTop(feed)
+	return e.limitFeed(feed)
+}
+
+// GetPostsByFlair returns the subreddit's posts tagged with flair, ignoring
+// case, in the order they were posted.
+func (e *Engine) GetPostsByFlair(subRedditName, flair string) ([]*Post, error) {
+	subReddit, err := e.lookupSubReddit(subRedditName)
+	if err != nil {
+		return nil, err
+	}
+	subReddit.Mutex.RLock()
+	defer subReddit.Mutex.RUnlock()
+	posts := []*Post{}
+	for _, post := range subReddit.Posts {
+		if strings.EqualFold(post.Flair, flair) {
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
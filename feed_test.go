@@ -0,0 +1,466 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetFeedsIgnoresRepeatedUsers(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	e.CreatePost(user, "sub", "post")
+
+	feeds := e.GetFeeds([]*User{user, user})
+	if got, want := len(feeds[user.ID]), len(e.GetUserFeed(user)); got != want {
+		t.Fatalf("GetFeeds gave %d posts, GetUserFeed %d", got, want)
+	}
+}
+
+func TestGetUserFeedRanksByHotScore(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	author, _ := e.RegisterUser("author")
+	voter, _ := e.RegisterUser("voter")
+	e.CreateSubReddit(author, "sub")
+	e.VoteWeightFn = func(*User) int { return 100 }
+
+	popular, _ := e.CreatePost(author, "sub", "old but popular")
+	e.UpvotePost(voter, popular)
+	*now = now.Add(12 * time.Hour)
+	modest, _ := e.CreatePost(author, "sub", "newer, one vote")
+	e.VoteWeightFn = nil
+	e.UpvotePost(voter, modest)
+	*now = now.Add(48 * time.Hour)
+	fresh, _ := e.CreatePost(author, "sub", "brand new")
+
+	feed := e.GetUserFeed(author)
+	want := []*Post{fresh, popular, modest}
+	if len(feed) != len(want) {
+		t.Fatalf("feed has %d posts, want %d", len(feed), len(want))
+	}
+	for i := range want {
+		if feed[i] != want[i] {
+			t.Fatalf("feed[%d] = post %d, want post %d", i, feed[i].ID, want[i].ID)
+		}
+	}
+}
+
+// postIDs lists the IDs of posts in order, for readable failure messages.
+func postIDs(posts []*Post) []int {
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	return ids
+}
+
+func TestGetUserFeedNewOrdersByRecency(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	first, _ := e.CreatePost(user, "sub", "first")
+	*now = now.Add(time.Hour)
+	second, _ := e.CreatePost(user, "sub", "second")
+	tied, _ := e.CreatePost(user, "sub", "same time as second")
+	*now = now.Add(time.Hour)
+	latest, _ := e.CreatePost(user, "sub", "latest")
+
+	got := postIDs(e.GetUserFeedNew(user))
+	want := []int{latest.ID, tied.ID, second.ID, first.ID}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("new feed = %v, want %v", got, want)
+	}
+}
+
+func TestConcurrentFeedReadsAndWrites(t *testing.T) {
+	e := NewEngine()
+	reader, _ := e.RegisterUser("reader")
+	writer, _ := e.RegisterUser("writer")
+	e.CreateSubReddit(writer, "sub")
+	e.JoinSubReddit(reader, "sub")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			post, _ := e.CreatePost(writer, "sub", fmt.Sprintf("post %d", i))
+			e.UpvotePost(reader, post)
+			e.SendDirectMessage(writer, reader, "hi")
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				e.GetUserFeed(reader)
+				e.RetrieveMessages(reader)
+				e.GetUser(writer.ID)
+				e.GetSubReddit("sub")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if feed := e.GetUserFeed(reader); len(feed) != 100 {
+		t.Fatalf("feed has %d posts, want 100", len(feed))
+	}
+}
+
+func BenchmarkConcurrentFeedReads(b *testing.B) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("sub%d", i)
+		e.CreateSubReddit(user, name)
+		for j := 0; j < 20; j++ {
+			e.CreatePost(user, name, fmt.Sprintf("post %d", j))
+		}
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			e.GetUserFeed(user)
+		}
+	})
+}
+
+func TestGetSubRedditFeedSortModes(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	author, _ := e.RegisterUser("author")
+	voter, _ := e.RegisterUser("voter")
+	e.CreateSubReddit(author, "sub")
+	e.CreateSubReddit(author, "other")
+	e.VoteWeightFn = func(*User) int { return 100 }
+	popular, _ := e.CreatePost(author, "sub", "popular")
+	e.UpvotePost(voter, popular)
+	e.VoteWeightFn = nil
+	*now = now.Add(6 * time.Hour)
+	middle, _ := e.CreatePost(author, "sub", "middle")
+	e.UpvotePost(voter, middle)
+	*now = now.Add(42 * time.Hour)
+	fresh, _ := e.CreatePost(author, "sub", "fresh")
+	e.CreatePost(author, "other", "elsewhere")
+
+	for _, tc := range []struct {
+		mode string
+		want []*Post
+	}{
+		{"hot", []*Post{fresh, popular, middle}},
+		{"new", []*Post{fresh, middle, popular}},
+		{"top", []*Post{popular, middle, fresh}},
+		{"bogus", []*Post{fresh, popular, middle}},
+	} {
+		feed, err := e.GetSubRedditFeed("sub", tc.mode)
+		if err != nil {
+			t.Fatalf("GetSubRedditFeed(%q): %v", tc.mode, err)
+		}
+		if got, want := postIDs(feed), postIDs(tc.want); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s feed = %v, want %v", tc.mode, got, want)
+		}
+	}
+	if _, err := e.GetSubRedditFeed("missing", "hot"); err != ErrSubRedditNotFound {
+		t.Fatalf("GetSubRedditFeed(missing) = %v, want ErrSubRedditNotFound", err)
+	}
+}
+
+func TestGetUserFeedTopWindow(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	author, _ := e.RegisterUser("author")
+	voter, _ := e.RegisterUser("voter")
+	e.CreateSubReddit(author, "sub")
+	e.VoteWeightFn = func(*User) int { return 10 }
+	old, _ := e.CreatePost(author, "sub", "old favourite")
+	e.UpvotePost(voter, old)
+	e.VoteWeightFn = nil
+	*now = now.Add(72 * time.Hour)
+	recent, _ := e.CreatePost(author, "sub", "recent")
+	e.UpvotePost(voter, recent)
+	*now = now.Add(time.Hour)
+	tiedOlder, _ := e.CreatePost(author, "sub", "unvoted")
+	*now = now.Add(time.Hour)
+	tiedNewer, _ := e.CreatePost(author, "sub", "unvoted, newer")
+
+	if got, want := postIDs(e.GetUserFeedTop(author, 24*time.Hour)), postIDs([]*Post{recent, tiedNewer, tiedOlder}); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("top of the last day = %v, want %v", got, want)
+	}
+	for _, since := range []time.Duration{0, -time.Hour} {
+		got := postIDs(e.GetUserFeedTop(author, since))
+		if want := postIDs([]*Post{old, recent, tiedNewer, tiedOlder}); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("all-time top (since %v) = %v, want %v", since, got, want)
+		}
+	}
+}
+
+func TestGetControversialFavoursEvenSplits(t *testing.T) {
+	e := NewEngine()
+	author, _ := e.RegisterUser("author")
+	e.CreateSubReddit(author, "sub")
+	split, _ := e.CreatePost(author, "sub", "split")
+	lopsided, _ := e.CreatePost(author, "sub", "lopsided")
+	unanimous, _ := e.CreatePost(author, "sub", "unanimous")
+	for i := 0; i < 10; i++ {
+		voter, _ := e.RegisterUser(fmt.Sprintf("voter%d", i))
+		if i%2 == 0 {
+			e.UpvotePost(voter, split)
+		} else {
+			e.DownvotePost(voter, split)
+		}
+		if i == 0 {
+			e.DownvotePost(voter, lopsided)
+		} else {
+			e.UpvotePost(voter, lopsided)
+		}
+		e.UpvotePost(voter, unanimous)
+	}
+
+	if split.Upvotes != 5 || split.Downvotes != 5 {
+		t.Fatalf("split post has %d up, %d down", split.Upvotes, split.Downvotes)
+	}
+	got := postIDs(e.GetControversial(author))
+	if want := postIDs([]*Post{split, lopsided, unanimous}); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("controversial feed = %v, want %v", got, want)
+	}
+}
+
+func TestGetPostsByFlair(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	question, _ := e.CreatePostWithFlair(user, "sub", "how do I…?", "Question")
+	news, _ := e.CreatePostWithFlair(user, "sub", "release notes", "News")
+	plain, _ := e.CreatePost(user, "sub", "no flair")
+	another, _ := e.CreatePostWithFlair(user, "sub", "why does…?", "question")
+	if news.Flair != "News" || plain.Flair != "" {
+		t.Fatalf("flairs = %q, %q", news.Flair, plain.Flair)
+	}
+
+	for _, tc := range []struct {
+		flair string
+		want  []*Post
+	}{
+		{"question", []*Post{question, another}},
+		{"NEWS", []*Post{news}},
+		{"", []*Post{plain}},
+		{"meta", nil},
+	} {
+		posts, err := e.GetPostsByFlair("sub", tc.flair)
+		if err != nil {
+			t.Fatalf("GetPostsByFlair(%q): %v", tc.flair, err)
+		}
+		if got, want := postIDs(posts), postIDs(tc.want); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("flair %q = %v, want %v", tc.flair, got, want)
+		}
+	}
+	if _, err := e.GetPostsByFlair("missing", "news"); err != ErrSubRedditNotFound {
+		t.Fatalf("GetPostsByFlair(missing) = %v, want ErrSubRedditNotFound", err)
+	}
+}
+
+// newFeedFixture builds an engine of users with overlapping memberships
+// across subreddits, each holding a few posts.
+func newFeedFixture(tb testing.TB, numUsers, numSubReddits int) (*Engine, []*User) {
+	tb.Helper()
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	users := make([]*User, numUsers)
+	for i := range users {
+		users[i], _ = e.RegisterUser(fmt.Sprintf("user%d", i))
+	}
+	for s := 0; s < numSubReddits; s++ {
+		name := fmt.Sprintf("sub%d", s)
+		e.CreateSubReddit(nil, name)
+		for i, user := range users {
+			if (i+s)%3 != 0 {
+				e.JoinSubReddit(user, name)
+			}
+		}
+		for p := 0; p < 5; p++ {
+			*now = now.Add(time.Minute)
+			post, err := e.CreatePost(users[(s+p)%numUsers], name, fmt.Sprintf("post %d in %s", p, name))
+			if err != nil {
+				tb.Fatalf("CreatePost: %v", err)
+			}
+			e.UpvotePost(users[p%numUsers], post)
+		}
+	}
+	return e, users
+}
+
+func TestGetFeedsMatchesPerUserFeeds(t *testing.T) {
+	e, users := newFeedFixture(t, 12, 6)
+	loner, _ := e.RegisterUser("loner")
+	users = append(users, loner)
+
+	feeds := e.GetFeeds(users)
+	for _, user := range users {
+		got, want := postIDs(feeds[user.ID]), postIDs(e.GetUserFeed(user))
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: GetFeeds = %v, GetUserFeed = %v", user.Username, got, want)
+		}
+	}
+	if len(feeds[loner.ID]) != 0 {
+		t.Fatalf("user with no memberships got %v", postIDs(feeds[loner.ID]))
+	}
+}
+
+func BenchmarkGetFeeds(b *testing.B) {
+	e, users := newFeedFixture(b, 200, 20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.GetFeeds(users)
+	}
+}
+
+func BenchmarkGetUserFeedPerUser(b *testing.B) {
+	e, users := newFeedFixture(b, 200, 20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, user := range users {
+			e.GetUserFeed(user)
+		}
+	}
+}
+
+func TestNSFWPostsHiddenUnlessOptedIn(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	prude, _ := e.RegisterUser("prude")
+	adult, _ := e.RegisterUser("adult")
+	adult.ShowNSFW = true
+	e.CreateSubReddit(mod, "sub")
+	e.JoinSubReddit(prude, "sub")
+	e.JoinSubReddit(adult, "sub")
+	safe, _ := e.CreatePost(mod, "sub", "safe")
+	flagged, _ := e.CreatePost(mod, "sub", "flagged")
+
+	if err := e.MarkNSFW(prude, flagged.ID); err != ErrNotAuthorized {
+		t.Fatalf("MarkNSFW by a non-moderator = %v, want ErrNotAuthorized", err)
+	}
+	if err := e.MarkNSFW(mod, flagged.ID); err != nil {
+		t.Fatalf("MarkNSFW: %v", err)
+	}
+	if !flagged.NSFW {
+		t.Fatal("post was not flagged")
+	}
+	for name, feed := range map[string][]*Post{
+		"hot":           e.GetUserFeed(prude),
+		"new":           e.GetUserFeedNew(prude),
+		"top":           e.GetUserFeedTop(prude, 0),
+		"controversial": e.GetControversial(prude),
+	} {
+		for _, post := range feed {
+			if post.NSFW {
+				t.Errorf("%s feed showed NSFW post %d to a user who opted out", name, post.ID)
+			}
+		}
+	}
+	if got := postIDs(e.GetUserFeedNew(prude)); fmt.Sprint(got) != fmt.Sprint([]int{safe.ID}) {
+		t.Fatalf("opted-out feed = %v", got)
+	}
+	if got := postIDs(e.GetUserFeedNew(adult)); fmt.Sprint(got) != fmt.Sprint([]int{flagged.ID, safe.ID}) {
+		t.Fatalf("opted-in feed = %v", got)
+	}
+}
+
+func TestFeedLimitTruncatesAfterRanking(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	user, _ := e.RegisterUser("user")
+	voter, _ := e.RegisterUser("voter")
+	e.CreateSubReddit(user, "sub")
+	var posts []*Post
+	for i := 0; i < 5; i++ {
+		*now = now.Add(time.Hour)
+		post, _ := e.CreatePost(user, "sub", fmt.Sprintf("post %d", i))
+		posts = append(posts, post)
+	}
+	e.UpvotePost(voter, posts[1])
+	e.VoteWeightFn = func(*User) int { return 100 }
+	e.DownvotePost(voter, posts[4])
+	e.VoteWeightFn = nil
+	e.FeedLimit = 2
+
+	for _, tc := range []struct {
+		name string
+		feed []*Post
+		want []*Post
+	}{
+		{"hot", e.GetUserFeed(user), []*Post{posts[3], posts[2]}},
+		{"new", e.GetUserFeedNew(user), []*Post{posts[4], posts[3]}},
+		{"top", e.GetUserFeedTop(user, 0), []*Post{posts[1], posts[3]}},
+	} {
+		if got, want := postIDs(tc.feed), postIDs(tc.want); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s feed = %v, want %v", tc.name, got, want)
+		}
+	}
+	e.FeedLimit = 0
+	if got := len(e.GetUserFeed(user)); got != 5 {
+		t.Fatalf("unlimited feed has %d posts, want 5", got)
+	}
+}
+
+func TestGetUserFeedWithDiscoveryBackfills(t *testing.T) {
+	e := NewEngine()
+	setClock(e, testEpoch)
+	poster, _ := e.RegisterUser("poster")
+	voter, _ := e.RegisterUser("voter")
+	busy, _ := e.RegisterUser("busy")
+	newcomer, _ := e.RegisterUser("newcomer")
+	e.CreateSubReddit(poster, "home")
+	e.CreateSubReddit(poster, "trending")
+	e.JoinSubReddit(busy, "home")
+	e.JoinSubReddit(busy, "trending")
+	e.JoinSubReddit(newcomer, "home")
+	own, _ := e.CreatePost(poster, "home", "home post")
+	var trending []*Post
+	for i := 0; i < 4; i++ {
+		post, _ := e.CreatePost(poster, "trending", fmt.Sprintf("trending %d", i))
+		trending = append(trending, post)
+	}
+	e.UpvotePost(voter, trending[2])
+
+	if feed := e.GetUserFeedWithDiscovery(busy, 3); len(feed) != 5 {
+		t.Fatalf("well-subscribed feed = %v, want all 5 subscribed posts and no backfill", postIDs(feed))
+	}
+	feed := e.GetUserFeedWithDiscovery(newcomer, 3)
+	if got, want := postIDs(feed), postIDs([]*Post{own, trending[2], trending[3]}); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("backfilled feed = %v, want %v", got, want)
+	}
+	if got := len(e.GetUserFeedWithDiscovery(newcomer, 100)); got != 5 {
+		t.Fatalf("backfill with a large target has %d posts, want every post once", got)
+	}
+
+	e.FeedLimit = 2
+	if got := len(e.GetUserFeedWithDiscovery(busy, 3)); got != 2 {
+		t.Fatalf("subscribed feed under FeedLimit 2 has %d posts", got)
+	}
+	if got := len(e.GetUserFeedWithDiscovery(newcomer, 3)); got != 2 {
+		t.Fatalf("backfilled feed under FeedLimit 2 has %d posts", got)
+	}
+}
+
+func TestGetUserFeedContext(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	e.CreatePost(user, "sub", "post")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if feed, err := e.GetUserFeedContext(ctx, user); err != context.DeadlineExceeded || feed != nil {
+		t.Fatalf("expired feed = %v, %v; want nil, context.DeadlineExceeded", feed, err)
+	}
+	feed, err := e.GetUserFeedContext(context.Background(), user)
+	if err != nil || fmt.Sprint(postIDs(feed)) != fmt.Sprint(postIDs(e.GetUserFeed(user))) {
+		t.Fatalf("live feed = %v, %v; want GetUserFeed's result", postIDs(feed), err)
+	}
+}
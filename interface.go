@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// RedditEngine is the public surface of Engine, so callers can depend on it
+// and substitute a fake in tests or alternative front ends.
+type RedditEngine interface {
+	// Users
+	RegisterUser(username string) (*User, error)
+	RegisterUsers(usernames []string) ([]*User, error)
+	GetUser(id int) (*User, bool)
+	GetUserByName(username string) (*User, bool)
+	SnapshotUsers() []*User
+	SearchUsers(prefix string) []*User
+	Connect(user *User)
+	Disconnect(user *User)
+	BlockUser(blocker, blocked *User)
+	UnblockUser(blocker, blocked *User)
+	DeleteUser(userID int) error
+
+	// Subreddits
+	CreateSubReddit(creator *User, name string) *SubReddit
+	GetSubReddit(name string) (*SubReddit, bool)
+	SnapshotSubReddits() []*SubReddit
+	SubscriberCount(name string) (int, error)
+	PostCount(name string) (int, error)
+	GetSubRedditMembers(name string, offset, limit int) ([]*User, error)
+	JoinSubReddit(user *User, subRedditName string) error
+	LeaveSubReddit(user *User, subRedditName string) error
+	LeaveAllSubReddits(user *User) int
+	GetSubRedditInfo(name string) (string, []string, error)
+
+	// Posts and comments
+	CreatePost(user *User, subRedditName, content string) (*Post, error)
+	CanCreatePost(user *User, subRedditName, content string) error
+	CreatePostWithFlair(user *User, subRedditName, content, flair string) (*Post, error)
+	CreateRepost(user *User, originalPost *Post, subRedditName string) *Post
+	CrossPost(user *User, originalPost *Post, targetSubReddit string) (*Post, error)
+	SchedulePost(user *User, subRedditName, content string, publishAt time.Time) (*Post, error)
+	PublishDuePosts() []*Post
+	GetReposts(postID int) []*Post
+	GetPost(id int) (*Post, bool)
+	EditPost(author *User, postID int, newContent string) error
+	DeletePost(author *User, postID int) error
+	CommentPost(user *User, post *Post, content string) (*Comment, error)
+	AddReplyToComment(user *User, parentComment *Comment, content string) (*Comment, error)
+	AddReply(user *User, postID, parentCommentID int, content string) (*Comment, error)
+	GetComment(postID, commentID int) (*Comment, bool)
+	GetPostComments(postID int, mode string) ([]*Comment, error)
+	EditComment(author *User, postID, commentID int, newContent string) error
+	DeleteComment(author *User, postID, commentID int) error
+	CommentTreeJSON(postID int) ([]byte, error)
+	SavePost(user *User, post *Post)
+	UnsavePost(user *User, post *Post)
+	GetSavedPosts(user *User) []*Post
+	ReportPost(reporter *User, postID int, reason string) error
+	ReportComment(reporter *User, postID, commentID int, reason string) error
+
+	// Votes, karma and awards
+	UpvotePost(user *User, post *Post) error
+	DownvotePost(user *User, post *Post) error
+	BatchVote(votes []VoteOp)
+	RemoveVote(user *User, post *Post) bool
+	UpvoteComment(comment *Comment)
+	DownvoteComment(comment *Comment)
+	VoteTally(post *Post) (up, down int)
+	GetSubRedditKarma(user *User, subRedditName string) int
+	ApplyKarmaDecay(halfLife time.Duration)
+	GiveAward(giver *User, post *Post, award Award)
+	GiveCommentAward(giver *User, comment *Comment, award Award)
+
+	// Messages and notifications
+	SendDirectMessage(from, to *User, content string) error
+	ReplyToMessage(user *User, original Message, content string) error
+	RetrieveMessages(user *User) []Message
+	MarkRead(user *User, msg *Message) error
+	DeleteMessage(user *User, msg *Message) error
+	UnreadCount(user *User) int
+	GetConversation(userA, userB *User) []Message
+	GetNotifications(user *User) []Notification
+	MarkNotificationsRead(user *User)
+	GetInbox(user *User) []InboxItem
+
+	// Feeds and search
+	GetUserFeed(user *User) []*Post
+	GetUserFeedContext(ctx context.Context, user *User) ([]*Post, error)
+	Subscribe(user *User) (<-chan *Post, func())
+	GetUserFeedNew(user *User) []*Post
+	GetUserFeedTop(user *User, since time.Duration) []*Post
+	GetUserFeedWithDiscovery(user *User, fillTo int) []*Post
+	GetControversial(user *User) []*Post
+	GetFeeds(users []*User) map[int][]*Post
+	GetSubRedditFeed(name, mode string) ([]*Post, error)
+	GetPostsByFlair(subRedditName, flair string) ([]*Post, error)
+	SearchPosts(query string) []*Post
+	SearchPostsContext(ctx context.Context, query string) ([]*Post, error)
+	SearchPostsInSubReddit(name, query string) ([]*Post, error)
+
+	// Moderation
+	IsModerator(subRedditName string, userID int) bool
+	AddModerator(mod, target *User, subRedditName string) error
+	RemoveModerator(mod, target *User, subRedditName string) error
+	RemovePost(mod *User, subRedditName string, postID int) error
+	RemoveComment(mod *User, postID, commentID int) error
+	LockPost(mod *User, postID int) error
+	UnlockPost(mod *User, postID int) error
+	PinPost(mod *User, postID int) error
+	UnpinPost(mod *User, postID int) error
+	MarkNSFW(mod *User, postID int) error
+	BanUser(mod, target *User, subRedditName string) error
+	UnbanUser(mod, target *User, subRedditName string) error
+	ApproveJoinRequest(mod, target *User, subRedditName string) error
+	DenyJoinRequest(mod, target *User, subRedditName string) error
+	SetSubRedditInfo(mod *User, name, description string, rules []string) error
+	GetModLog(mod *User, subRedditName string) ([]ModAction, error)
+	GetReports(mod *User, subRedditName string) ([]Report, error)
+	MergeSubReddits(admin *User, source, dest string) error
+	DetectBrigading(post *Post, window time.Duration, threshold int) bool
+
+	// Analytics and persistence
+	Metrics() Stats
+	GetTrendingSubReddits(limit int, window time.Duration) []SubRedditStats
+	GetTopUsersByKarma(limit int) []*User
+	GetUserPosts(userID int) []*Post
+	GetUserComments(userID int) []*Comment
+	GetUserOverview(userID int) []ActivityEvent
+	AuthorActivity(userID int, bucket time.Duration) map[time.Time]int
+	GetActivitySince(t time.Time) []ActivityEvent
+	SaveToJSON(w io.Writer) error
+}
+
+var _ RedditEngine = (*Engine)(nil)
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+)
+
+// fakeEngine is a trivial RedditEngine: it records registrations and
+// subreddit creation in memory. Embedding the interface satisfies the rest of
+// the method set; calling anything it doesn't override panics.
+type fakeEngine struct {
+	RedditEngine
+	users      []string
+	subReddits []string
+}
+
+func (f *fakeEngine) RegisterUser(username string) (*User, error) {
+	f.users = append(f.users, username)
+	return &User{ID: len(f.users), Username: username}, nil
+}
+
+func (f *fakeEngine) CreateSubReddit(creator *User, name string) *SubReddit {
+	f.subReddits = append(f.subReddits, name)
+	return &SubReddit{Name: name, DisplayName: name}
+}
+
+// seedCommunity is a caller that depends only on the interface.
+func seedCommunity(engine RedditEngine, name string, members ...string) error {
+	var founder *User
+	for _, member := range members {
+		user, err := engine.RegisterUser(member)
+		if err != nil {
+			return err
+		}
+		if founder == nil {
+			founder = user
+		}
+	}
+	if engine.CreateSubReddit(founder, name) == nil {
+		return fmt.Errorf("could not create %s", name)
+	}
+	return nil
+}
+
+func TestCallersCanSubstituteAFakeEngine(t *testing.T) {
+	fake := &fakeEngine{}
+	if err := seedCommunity(fake, "golang", "alice", "bob"); err != nil {
+		t.Fatalf("seedCommunity with fake: %v", err)
+	}
+	if fmt.Sprint(fake.users) != "[alice bob]" || fmt.Sprint(fake.subReddits) != "[golang]" {
+		t.Fatalf("fake saw users %v and subreddits %v", fake.users, fake.subReddits)
+	}
+
+	var real RedditEngine = NewEngine()
+	if err := seedCommunity(real, "golang", "alice", "bob"); err != nil {
+		t.Fatalf("seedCommunity with Engine: %v", err)
+	}
+	if _, ok := real.GetSubReddit("golang"); !ok {
+		t.Fatal("Engine did not create the subreddit")
+	}
+}
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Stats is a point-in-time snapshot of the engine's headline counters.
+type Stats struct {
+	Users             int
+	SubReddits        int
+	TotalPosts        int64
+	TotalComments     int64
+	TotalVotes        int64
+	TotalUpvotes      int64
+	TotalDownvotes    int64
+	TotalMessages     int64
+	TotalActions      int64
+	DisconnectedUsers int64
+	Throughput        float64
+}
+
+// Metrics snapshots the engine counters. Throughput is actions per second
+// since StartTime as measured by the engine clock.
+func (e *Engine) Metrics() Stats {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	stats := Stats{
+		Users:             len(e.Users),
+		SubReddits:        len(e.SubReddits),
+		TotalPosts:        e.TotalPosts.Load(),
+		TotalComments:     e.TotalComments.Load(),
+		TotalVotes:        e.TotalVotes.Load(),
+		TotalUpvotes:      e.TotalUpvotes.Load(),
+		TotalDownvotes:    e.TotalDownvotes.Load(),
+		TotalMessages:     e.TotalMessages.Load(),
+		TotalActions:      e.TotalActions.Load(),
+		DisconnectedUsers: e.DisconnectedUsers.Load(),
+	}
+	if elapsed := e.now().Sub(e.StartTime).Seconds(); elapsed > 0 {
+		stats.Throughput = float64(stats.TotalActions) / elapsed
+	}
+	return stats
+}
+
+// SubRedditStats summarises a subreddit's size and recent activity.
+type SubRedditStats struct {
+	Name        string
+	Members     int
+	PostCount   int
+	RecentPosts int
+	Score       float64
+}
+
+// GetTrendingSubReddits ranks subreddits by recent activity, with membership
+// as a log-scaled tiebreaker so a busy small community beats a dormant large
+// one. Posts created within window count as recent; a non-positive window
+// counts every post. A non-positive limit returns every subreddit.
+func (e *Engine) GetTrendingSubReddits(limit int, window time.Duration) []SubRedditStats {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	return e.trendingSubReddits(limit, window)
+}
+
+// trendingSubReddits ranks subreddits for GetTrendingSubReddits. Callers must
+// hold e.Mutex.
+func (e *Engine) trendingSubReddits(limit int, window time.Duration) []SubRedditStats {
+	cutoff := e.now().Add(-window)
+	trending := []SubRedditStats{}
+	for _, subreddit := range e.SubReddits {
+		subreddit.Mutex.RLock()
+		stats := SubRedditStats{
+			Name:      subreddit.DisplayName,
+			Members:   len(subreddit.Users),
+			PostCount: len(subreddit.Posts),
+		}
+		for _, post := range subreddit.Posts {
+			if window <= 0 || !post.CreatedAt.Before(cutoff) {
+				stats.RecentPosts++
+			}
+		}
+		subreddit.Mutex.RUnlock()
+		stats.Score = float64(stats.RecentPosts) + math.Log10(float64(stats.Members)+1)
+		trending = append(trending, stats)
+	}
+	sort.Slice(trending, func(i, j int) bool {
+		if trending[i].Score != trending[j].Score {
+			return trending[i].Score > trending[j].Score
+		}
+		return trending[i].Name < trending[j].Name
+	})
+	if limit > 0 && len(trending) > limit {
+		trending = trending[:limit]
+	}
+	return trending
+}
+
+// GetTopUsersByKarma returns users ordered by karma, highest first, with
+// username breaking ties. A non-positive limit returns every user.
+func (e *Engine) GetTopUsersByKarma(limit int) []*User {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	users := make([]*User, 0, len(e.Users))
+	for _, user := range e.Users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Karma != users[j].Karma {
+			return users[i].Karma > users[j].Karma
+		}
+		return users[i].Username < users[j].Username
+	})
+	if limit > 0 && len(users) > limit {
+		users = users[:limit]
+	}
+	return users
+}
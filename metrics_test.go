@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMetricsMatchesCounters(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	e.StartTime = testEpoch
+	alice, _ := e.RegisterUser("alice")
+	bob, _ := e.RegisterUser("bob")
+	carol, _ := e.RegisterUser("carol")
+	e.CreateSubReddit(alice, "sub")
+	post, _ := e.CreatePost(alice, "sub", "post")
+	e.CommentPost(bob, post, "comment")
+	e.UpvotePost(bob, post)
+	e.DownvotePost(carol, post)
+	e.SendDirectMessage(alice, bob, "hi")
+	e.Disconnect(carol)
+	*now = now.Add(10 * time.Second)
+
+	stats := e.Metrics()
+	want := Stats{
+		Users:             3,
+		SubReddits:        1,
+		TotalPosts:        1,
+		TotalComments:     1,
+		TotalVotes:        2,
+		TotalUpvotes:      1,
+		TotalDownvotes:    1,
+		TotalMessages:     1,
+		TotalActions:      e.TotalActions.Load(),
+		DisconnectedUsers: 1,
+		Throughput:        float64(e.TotalActions.Load()) / 10,
+	}
+	if stats != want {
+		t.Fatalf("Metrics() = %+v, want %+v", stats, want)
+	}
+	if stats.TotalActions == 0 {
+		t.Fatal("workload recorded no actions")
+	}
+}
+
+func TestTrendingFavoursRecentActivity(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	founder, _ := e.RegisterUser("founder")
+	e.CreateSubReddit(founder, "Dormant")
+	e.CreateSubReddit(founder, "Lively")
+	e.CreateSubReddit(founder, "Empty")
+	for i := 0; i < 20; i++ {
+		user, _ := e.RegisterUser(fmt.Sprintf("user%d", i))
+		e.JoinSubReddit(user, "dormant")
+		if i < 5 {
+			e.CreatePost(user, "dormant", "old news")
+		}
+	}
+	*now = now.Add(48 * time.Hour)
+	e.CreatePost(founder, "lively", "fresh")
+	e.CreatePost(founder, "lively", "fresher")
+
+	trending := e.GetTrendingSubReddits(0, 24*time.Hour)
+	var names []string
+	for _, stats := range trending {
+		names = append(names, stats.Name)
+	}
+	if fmt.Sprint(names) != "[Lively Dormant Empty]" {
+		t.Fatalf("trending = %v, want [Lively Dormant Empty]", names)
+	}
+	if lively, dormant := trending[0], trending[1]; lively.RecentPosts != 2 || dormant.RecentPosts != 0 ||
+		dormant.PostCount != 5 || dormant.Members <= lively.Members {
+		t.Fatalf("stats = %+v, %+v", lively, dormant)
+	}
+	if got := e.GetTrendingSubReddits(1, 24*time.Hour); len(got) != 1 || got[0].Name != "Lively" {
+		t.Fatalf("limit 1 = %+v", got)
+	}
+	if got := e.GetTrendingSubReddits(0, 0); got[0].Name != "Dormant" || got[0].RecentPosts != 5 {
+		t.Fatalf("with no window every post counts, got %+v", got[0])
+	}
+}
+
+func TestGetTopUsersByKarma(t *testing.T) {
+	e := NewEngine()
+	for name, karma := range map[string]int{"dave": 0, "bob": 5, "alice": 5, "carol": 10} {
+		user, _ := e.RegisterUser(name)
+		user.Karma = karma
+	}
+
+	if got := usernames(e.GetTopUsersByKarma(0)); fmt.Sprint(got) != "[carol alice bob dave]" {
+		t.Fatalf("all users = %v", got)
+	}
+	if got := usernames(e.GetTopUsersByKarma(-1)); len(got) != 4 {
+		t.Fatalf("negative limit returned %v", got)
+	}
+	top := e.GetTopUsersByKarma(2)
+	if got := usernames(top); fmt.Sprint(got) != "[carol alice]" {
+		t.Fatalf("top two = %v", got)
+	}
+	top[0] = nil
+	if again := e.GetTopUsersByKarma(1); again[0] == nil || again[0].Username != "carol" {
+		t.Fatal("result shares storage with the engine")
+	}
+}
@@ -0,0 +1,605 @@
+package engine
+
+import (
+	"sort"
+	"time"
+)
+
+// ModAction records one moderator action in a subreddit's mod log. TargetID
+// is the user acted on, or the post or comment for removals.
+type ModAction struct {
+	Type        ActivityType
+	ModeratorID int
+	TargetID    int
+	Timestamp   time.Time
+}
+
+func (e *Engine) IsModerator(subRedditName string, userID int) bool {
+	subReddit, err := e.lookupSubReddit(subRedditName)
+	if err != nil {
+		return false
+	}
+	subReddit.Mutex.RLock()
+	defer subReddit.Mutex.RUnlock()
+	return isModerator(subReddit, userID)
+}
+
+// isModerator reports whether userID moderates subReddit. Callers must hold
+// subReddit.Mutex.
+func isModerator(subReddit *SubReddit, userID int) bool {
+	_, ok := subReddit.Moderators[userID]
+	return ok
+}
+
+// lockModerated looks up a subreddit, locks it and checks that mod moderates
+// it. On success the caller holds subReddit.Mutex and must unlock it.
+func (e *Engine) lockModerated(mod *User, subRedditName string) (*SubReddit, error) {
+	subReddit, err := e.lookupSubReddit(subRedditName)
+	if err != nil {
+		return nil, err
+	}
+	subReddit.Mutex.Lock()
+	if subReddit.merged {
+		subReddit.Mutex.Unlock()
+		return nil, ErrSubRedditNotFound
+	}
+	if !isModerator(subReddit, mod.ID) {
+		subReddit.Mutex.Unlock()
+		return nil, ErrNotAuthorized
+	}
+	return subReddit, nil
+}
+
+func (e *Engine) AddModerator(mod, target *User, subRedditName string) error {
+	subReddit, err := e.lockModerated(mod, subRedditName)
+	if err != nil {
+		return err
+	}
+	defer subReddit.Mutex.Unlock()
+	subReddit.Moderators[target.ID] = target
+	subReddit.Users[target.ID] = target
+	e.logActivity(ActivityAddModerator, mod.ID, target.ID, subReddit.Name)
+	return nil
+}
+
+func (e *Engine) RemoveModerator(mod, target *User, subRedditName string) error {
+	subReddit, err := e.lockModerated(mod, subRedditName)
+	if err != nil {
+		return err
+	}
+	defer subReddit.Mutex.Unlock()
+	delete(subReddit.Moderators, target.ID)
+	e.logActivity(ActivityRemoveModerator, mod.ID, target.ID, subReddit.Name)
+	return nil
+}
+
+// RemovePost takes a post out of its subreddit and takes back the vote karma
+// its author is still credited for it.
+func (e *Engine) RemovePost(mod *User, subRedditName string, postID int) error {
+	subReddit, err := e.lockModerated(mod, subRedditName)
+	if err != nil {
+		return err
+	}
+	var removed *Post
+	for i, post := range subReddit.Posts {
+		if post.ID == postID {
+			removed = post
+			subReddit.Posts = append(subReddit.Posts[:i], subReddit.Posts[i+1:]...)
+			e.unindexPost(postID)
+			e.recordModAction(subReddit, ActivityRemovePost, mod.ID, postID)
+			break
+		}
+	}
+	subReddit.Mutex.Unlock()
+	if removed == nil {
+		return ErrPostNotFound
+	}
+	e.TotalPosts.Add(-1)
+	e.logActivity(ActivityRemovePost, mod.ID, postID, subReddit.Name)
+
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	e.creditVoteKarma(removed, -removed.voteKarma)
+	return nil
+}
+
+// RemoveComment blanks a comment to "[removed]", leaving its replies in place,
+// marks it removed so it can no longer be edited, and takes back the karma
+// its author earned from it.
+func (e *Engine) RemoveComment(mod *User, postID, commentID int) error {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	post, err := e.moderatedPost(mod, postID)
+	if err != nil {
+		return err
+	}
+	comment := findComment(post.Comments, commentID)
+	if comment == nil {
+		return ErrCommentNotFound
+	}
+	comment.Content = "[removed]"
+	comment.Removed = true
+	comment.Author.addCommentKarma(-comment.Score())
+	e.addSubRedditKarma(comment.Author, post.SubReddit, -comment.Score())
+	comment.Upvotes, comment.Downvotes = 0, 0
+
+	subReddit := e.SubReddits[post.SubReddit]
+	subReddit.Mutex.Lock()
+	e.recordModAction(subReddit, ActivityRemoveComment, mod.ID, commentID)
+	subReddit.Mutex.Unlock()
+	e.logActivity(ActivityRemoveComment, mod.ID, commentID, post.SubReddit)
+	return nil
+}
+
+// LockPost stops new comments and replies on a post.
+func (e *Engine) LockPost(mod *User, postID int) error {
+	return e.setPostLocked(mod, postID, true)
+}
+
+func (e *Engine) UnlockPost(mod *User, postID int) error {
+	return e.setPostLocked(mod, postID, false)
+}
+
+func (e *Engine) setPostLocked(mod *User, postID int, locked bool) error {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	post, err := e.moderatedPost(mod, postID)
+	if err != nil {
+		return err
+	}
+	post.Locked = locked
+	kind := ActivityLockPost
+	if !locked {
+		kind = ActivityUnlockPost
+	}
+	e.logActivity(kind, mod.ID, postID, post.SubReddit)
+	return nil
+}
+
+// MarkNSFW flags a post as not safe for work, hiding it from the feeds of
+// users who haven't opted in.
+func (e *Engine) MarkNSFW(mod *User, postID int) error {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	post, err := e.moderatedPost(mod, postID)
+	if err != nil {
+		return err
+	}
+	post.NSFW = true
+	e.logActivity(ActivityMarkNSFW, mod.ID, postID, post.SubReddit)
+	return nil
+}
+
+// PinPost pins a post to the top of its subreddit's feed, up to
+// MaxPinnedPosts per subreddit. A non-positive MaxPinnedPosts means no limit.
+func (e *Engine) PinPost(mod *User, postID int) error {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	post, err := e.moderatedPost(mod, postID)
+	if err != nil {
+		return err
+	}
+	if post.Pinned {
+		return nil
+	}
+	if e.MaxPinnedPosts > 0 {
+		subReddit := e.SubReddits[post.SubReddit]
+		pinned := 0
+		subReddit.Mutex.RLock()
+		for _, candidate := range subReddit.Posts {
+			if candidate.Pinned {
+				pinned++
+			}
+		}
+		subReddit.Mutex.RUnlock()
+		if pinned >= e.MaxPinnedPosts {
+			return ErrTooManyPinned
+		}
+	}
+	post.Pinned = true
+	e.logActivity(ActivityPinPost, mod.ID, postID, post.SubReddit)
+	return nil
+}
+
+func (e *Engine) UnpinPost(mod *User, postID int) error {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	post, err := e.moderatedPost(mod, postID)
+	if err != nil {
+		return err
+	}
+	post.Pinned = false
+	e.logActivity(ActivityUnpinPost, mod.ID, postID, post.SubReddit)
+	return nil
+}
+
+// moderatedPost looks up a post and checks that mod moderates its subreddit.
+// Callers must hold e.Mutex.
+func (e *Engine) moderatedPost(mod *User, postID int) (*Post, error) {
+	post, exists := e.GetPost(postID)
+	if !exists {
+		return nil, ErrPostNotFound
+	}
+	subReddit, exists := e.SubReddits[post.SubReddit]
+	if !exists {
+		return nil, ErrSubRedditNotFound
+	}
+	subReddit.Mutex.RLock()
+	defer subReddit.Mutex.RUnlock()
+	if !isModerator(subReddit, mod.ID) {
+		return nil, ErrNotAuthorized
+	}
+	return post, nil
+}
+
+// DeletePost lets a post's author or a moderator delete it. A post that has
+// comments is blanked and handed to the deleted-user sentinel so the thread
+// survives; a post without comments is removed outright.
+func (e *Engine) DeletePost(author *User, postID int) error {
+	post, exists := e.GetPost(postID)
+	if !exists {
+		return ErrPostNotFound
+	}
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	subReddit, exists := e.SubReddits[post.SubReddit]
+	if !exists {
+		return ErrSubRedditNotFound
+	}
+	subReddit.Mutex.Lock()
+	defer subReddit.Mutex.Unlock()
+	if post.Author.ID != author.ID && !isModerator(subReddit, author.ID) {
+		return ErrNotAuthorized
+	}
+
+	e.logActivity(ActivityDeletePost, author.ID, postID, subReddit.Name)
+	if len(post.Comments) > 0 {
+		post.Content = "[deleted]"
+		post.Author = e.DeletedUser
+		return nil
+	}
+	for i, candidate := range subReddit.Posts {
+		if candidate == post {
+			subReddit.Posts = append(subReddit.Posts[:i], subReddit.Posts[i+1:]...)
+			break
+		}
+	}
+	e.unindexPost(postID)
+	e.TotalPosts.Add(-1)
+	return nil
+}
+
+// DeleteComment lets a comment's author or a moderator delete it. A comment
+// with replies keeps its place in the tree as a "[deleted]" placeholder;
+// otherwise it is unlinked and the post's CommentCount drops by one.
+func (e *Engine) DeleteComment(author *User, postID, commentID int) error {
+	post, exists := e.GetPost(postID)
+	if !exists {
+		return ErrPostNotFound
+	}
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	subReddit, exists := e.SubReddits[post.SubReddit]
+	if !exists {
+		return ErrSubRedditNotFound
+	}
+	comment := findComment(post.Comments, commentID)
+	if comment == nil {
+		return ErrCommentNotFound
+	}
+	subReddit.Mutex.RLock()
+	isMod := isModerator(subReddit, author.ID)
+	subReddit.Mutex.RUnlock()
+	if comment.Author.ID != author.ID && !isMod {
+		return ErrNotAuthorized
+	}
+
+	e.logActivity(ActivityDeleteComment, author.ID, commentID, subReddit.Name)
+	if len(comment.Replies) > 0 {
+		comment.Content = "[deleted]"
+		comment.Author = e.DeletedUser
+		return nil
+	}
+	post.Comments = unlinkComment(post.Comments, commentID)
+	post.CommentCount--
+	e.TotalComments.Add(-1)
+	return nil
+}
+
+// unlinkComment returns comments with the comment whose ID is commentID
+// removed from wherever it sits in the tree.
+func unlinkComment(comments []*Comment, commentID int) []*Comment {
+	for i, comment := range comments {
+		if comment.ID == commentID {
+			return append(comments[:i], comments[i+1:]...)
+		}
+		comment.Replies = unlinkComment(comment.Replies, commentID)
+	}
+	return comments
+}
+
+// BanUser removes target from the subreddit, discarding any pending join
+// request, and keeps them from rejoining or posting until they are unbanned.
+func (e *Engine) BanUser(mod, target *User, subRedditName string) error {
+	subReddit, err := e.lockModerated(mod, subRedditName)
+	if err != nil {
+		return err
+	}
+	defer subReddit.Mutex.Unlock()
+	subReddit.Banned[target.ID] = true
+	delete(subReddit.Users, target.ID)
+	delete(subReddit.Moderators, target.ID)
+	dropJoinRequest(subReddit, target.ID)
+	e.recordModAction(subReddit, ActivityBan, mod.ID, target.ID)
+	e.logActivity(ActivityBan, mod.ID, target.ID, subReddit.Name)
+	return nil
+}
+
+func (e *Engine) UnbanUser(mod, target *User, subRedditName string) error {
+	subReddit, err := e.lockModerated(mod, subRedditName)
+	if err != nil {
+		return err
+	}
+	defer subReddit.Mutex.Unlock()
+	delete(subReddit.Banned, target.ID)
+	e.recordModAction(subReddit, ActivityUnban, mod.ID, target.ID)
+	e.logActivity(ActivityUnban, mod.ID, target.ID, subReddit.Name)
+	return nil
+}
+
+// SetSubRedditInfo replaces the subreddit's description and rules.
+func (e *Engine) SetSubRedditInfo(mod *User, name, description string, rules []string) error {
+	subReddit, err := e.lockModerated(mod, name)
+	if err != nil {
+		return err
+	}
+	defer subReddit.Mutex.Unlock()
+	subReddit.Description = description
+	subReddit.Rules = append([]string{}, rules...)
+	e.logActivity(ActivityUpdateInfo, mod.ID, 0, subReddit.Name)
+	return nil
+}
+
+// GetSubRedditInfo returns the subreddit's description and a copy of its rules.
+func (e *Engine) GetSubRedditInfo(name string) (string, []string, error) {
+	subReddit, err := e.lookupSubReddit(name)
+	if err != nil {
+		return "", nil, err
+	}
+	subReddit.Mutex.RLock()
+	defer subReddit.Mutex.RUnlock()
+	return subReddit.Description, append([]string{}, subReddit.Rules...), nil
+}
+
+// GetModLog returns a copy of the subreddit's mod log, oldest first. Only
+// moderators may read it.
+func (e *Engine) GetModLog(mod *User, subRedditName string) ([]ModAction, error) {
+	subReddit, err := e.lockModerated(mod, subRedditName)
+	if err != nil {
+		return nil, err
+	}
+	defer subReddit.Mutex.Unlock()
+	return append([]ModAction{}, subReddit.ModLog...), nil
+}
+
+// recordModAction appends to the subreddit's mod log. Callers must hold
+// subReddit.Mutex.
+func (e *Engine) recordModAction(subReddit *SubReddit, kind ActivityType, modID, targetID int) {
+	subReddit.ModLog = append(subReddit.ModLog, ModAction{
+		Type:        kind,
+		ModeratorID: modID,
+		TargetID:    targetID,
+		Timestamp:   e.now(),
+	})
+}
+
+// Report is a user's complaint about a post or, when CommentID is set, one
+// of its comments, queued for the subreddit's moderators.
+type Report struct {
+	ReporterID int
+	PostID     int
+	CommentID  int
+	Reason     string
+	CreatedAt  time.Time
+}
+
+// ReportPost adds a report to the queue of the post's subreddit.
+func (e *Engine) ReportPost(reporter *User, postID int, reason string) error {
+	post, exists := e.GetPost(postID)
+	if !exists {
+		return ErrPostNotFound
+	}
+	return e.fileReport(reporter, post, 0, reason)
+}
+
+// ReportComment adds a report about a comment to the queue of its post's
+// subreddit.
+func (e *Engine) ReportComment(reporter *User, postID, commentID int, reason string) error {
+	post, exists := e.GetPost(postID)
+	if !exists {
+		return ErrPostNotFound
+	}
+	return e.fileReport(reporter, post, commentID, reason)
+}
+
+// fileReport queues a report on post, or on its comment commentID when that
+// is non-zero. The post's subreddit is resolved under e.Mutex so a concurrent
+// merge cannot move the post between the lookup and the append.
+func (e *Engine) fileReport(reporter *User, post *Post, commentID int, reason string) error {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	if commentID != 0 && findComment(post.Comments, commentID) == nil {
+		return ErrCommentNotFound
+	}
+	subReddit, exists := e.SubReddits[subRedditKey(post.SubReddit)]
+	if !exists {
+		return ErrSubRedditNotFound
+	}
+	subReddit.Mutex.Lock()
+	subReddit.Reports = append(subReddit.Reports, Report{
+		ReporterID: reporter.ID,
+		PostID:     post.ID,
+		CommentID:  commentID,
+		Reason:     reason,
+		CreatedAt:  e.now(),
+	})
+	subReddit.Mutex.Unlock()
+	e.TotalReports.Add(1)
+	target := post.ID
+	if commentID != 0 {
+		target = commentID
+	}
+	e.logActivity(ActivityReport, reporter.ID, target, subReddit.Name)
+	return nil
+}
+
+// GetReports returns a copy of the subreddit's report queue, oldest first.
+// Only moderators may read it.
+func (e *Engine) GetReports(mod *User, subRedditName string) ([]Report, error) {
+	subReddit, err := e.lockModerated(mod, subRedditName)
+	if err != nil {
+		return nil, err
+	}
+	defer subReddit.Mutex.Unlock()
+	return append([]Report{}, subReddit.Reports...), nil
+}
+
+// pendingIndex returns the position of userID in the subreddit's join queue,
+// or -1. Callers must hold subReddit.Mutex.
+func pendingIndex(subReddit *SubReddit, userID int) int {
+	for i, user := range subReddit.PendingRequests {
+		if user.ID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+// dropJoinRequest removes userID from the subreddit's join queue, reporting
+// whether they were waiting. Callers must hold subReddit.Mutex.
+func dropJoinRequest(subReddit *SubReddit, userID int) bool {
+	i := pendingIndex(subReddit, userID)
+	if i < 0 {
+		return false
+	}
+	subReddit.PendingRequests = append(subReddit.PendingRequests[:i], subReddit.PendingRequests[i+1:]...)
+	return true
+}
+
+func (e *Engine) ApproveJoinRequest(mod, target *User, subRedditName string) error {
+	subReddit, err := e.takeJoinRequest(mod, target, subRedditName)
+	if err != nil {
+		return err
+	}
+	defer subReddit.Mutex.Unlock()
+	if subReddit.Banned[target.ID] {
+		return ErrBanned
+	}
+	subReddit.Users[target.ID] = target
+	e.recordModAction(subReddit, ActivityApproveJoin, mod.ID, target.ID)
+	e.logActivity(ActivityApproveJoin, mod.ID, target.ID, subReddit.Name)
+	return nil
+}
+
+func (e *Engine) DenyJoinRequest(mod, target *User, subRedditName string) error {
+	subReddit, err := e.takeJoinRequest(mod, target, subRedditName)
+	if err != nil {
+		return err
+	}
+	subReddit.Mutex.Unlock()
+	e.logActivity(ActivityDenyJoin, mod.ID, target.ID, subReddit.Name)
+	return nil
+}
+
+// takeJoinRequest checks mod's authority and removes target from the join
+// queue. On success the caller holds subReddit.Mutex and must unlock it.
+func (e *Engine) takeJoinRequest(mod, target *User, subRedditName string) (*SubReddit, error) {
+	subReddit, err := e.lockModerated(mod, subRedditName)
+	if err != nil {
+		return nil, err
+	}
+	if !dropJoinRequest(subReddit, target.ID) {
+		subReddit.Mutex.Unlock()
+		return nil, ErrNoJoinRequest
+	}
+	return subReddit, nil
+}
+
+// MergeSubReddits folds source into dest and deletes source. admin must
+// moderate both. Source's posts, reports, mod log and per-subreddit karma move
+// to dest, and posts scheduled for source are retargeted. Source's members
+// join dest as plain members, or queue for approval if dest is private, and
+// its pending join requests carry over; anyone banned from dest is left out.
+// Moved posts are unpinned so dest's pin limit still holds.
+func (e *Engine) MergeSubReddits(admin *User, source, dest string) error {
+	sourceKey, destKey := subRedditKey(source), subRedditKey(dest)
+	if sourceKey == destKey {
+		return ErrSameSubReddit
+	}
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	from, exists := e.SubReddits[sourceKey]
+	if !exists {
+		return ErrSubRedditNotFound
+	}
+	to, exists := e.SubReddits[destKey]
+	if !exists {
+		return ErrSubRedditNotFound
+	}
+	from.Mutex.Lock()
+	defer from.Mutex.Unlock()
+	to.Mutex.Lock()
+	defer to.Mutex.Unlock()
+	if !isModerator(from, admin.ID) || !isModerator(to, admin.ID) {
+		return ErrNotAuthorized
+	}
+
+	for _, post := range from.Posts {
+		post.SubReddit = to.Name
+		post.Pinned = false
+	}
+	to.Posts = append(to.Posts, from.Posts...)
+	to.Reports = append(to.Reports, from.Reports...)
+	for _, id := range userIDs(from.Users) {
+		if to.Private {
+			queueJoinRequest(to, from.Users[id])
+		} else if !to.Banned[id] {
+			to.Users[id] = from.Users[id]
+		}
+	}
+	for _, user := range from.PendingRequests {
+		queueJoinRequest(to, user)
+	}
+	to.ModLog = append(to.ModLog, from.ModLog...)
+	sort.SliceStable(to.ModLog, func(i, j int) bool {
+		return to.ModLog[i].Timestamp.Before(to.ModLog[j].Timestamp)
+	})
+	e.recordModAction(to, ActivityMergeSubReddit, admin.ID, 0)
+	for key, karma := range e.subRedditKarma {
+		if key.subReddit == from.Name {
+			delete(e.subRedditKarma, key)
+			e.subRedditKarma[subRedditKarmaKey{key.userID, to.Name}] += karma
+		}
+	}
+	for _, post := range e.scheduled {
+		if post.SubReddit == from.Name {
+			post.SubReddit = to.Name
+		}
+	}
+	from.merged = true
+	delete(e.SubReddits, from.Name)
+	e.logActivity(ActivityMergeSubReddit, admin.ID, 0, to.Name)
+	return nil
+}
+
+// queueJoinRequest adds user to the subreddit's join queue unless they are
+// banned, already a member or already waiting. Callers must hold
+// subReddit.Mutex.
+func queueJoinRequest(subReddit *SubReddit, user *User) {
+	if _, member := subReddit.Users[user.ID]; member || subReddit.Banned[user.ID] {
+		return
+	}
+	if pendingIndex(subReddit, user.ID) < 0 {
+		subReddit.PendingRequests = append(subReddit.PendingRequests, user)
+	}
+}
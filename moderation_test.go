@@ -0,0 +1,695 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMergeSubRedditsUnionsMembersOnly(t *testing.T) {
+	e := NewEngine()
+	admin, _ := e.RegisterUser("admin")
+	sourceMod, _ := e.RegisterUser("sourcemod")
+	member, _ := e.RegisterUser("member")
+	waiting, _ := e.RegisterUser("waiting")
+	spammer, _ := e.RegisterUser("spammer")
+	source := e.CreateSubReddit(sourceMod, "source")
+	e.AddModerator(sourceMod, admin, "source")
+	e.JoinSubReddit(member, "source")
+	e.BanUser(sourceMod, spammer, "source")
+	source.Private = true
+	e.JoinSubReddit(waiting, "source")
+	dest := e.CreateSubReddit(admin, "dest")
+
+	if err := e.MergeSubReddits(admin, "source", "dest"); err != nil {
+		t.Fatalf("MergeSubReddits: %v", err)
+	}
+	if isModerator(dest, sourceMod.ID) {
+		t.Fatal("source moderator became a moderator of dest")
+	}
+	if _, ok := dest.Users[sourceMod.ID]; !ok {
+		t.Fatal("source moderator did not join dest as a member")
+	}
+	if _, ok := dest.Users[member.ID]; !ok {
+		t.Fatal("source member did not join dest")
+	}
+	if pendingIndex(dest, waiting.ID) < 0 {
+		t.Fatal("pending join request was dropped")
+	}
+	if len(dest.ModLog) != 2 || dest.ModLog[0].Type != ActivityBan || dest.ModLog[1].Type != ActivityMergeSubReddit {
+		t.Fatalf("mod log = %+v, want source's ban then the merge", dest.ModLog)
+	}
+}
+
+func TestMergedSubRedditRejectsStaleWriters(t *testing.T) {
+	e := NewEngine()
+	admin, _ := e.RegisterUser("admin")
+	user, _ := e.RegisterUser("user")
+	source := e.CreateSubReddit(admin, "source")
+	dest := e.CreateSubReddit(admin, "dest")
+
+	var wg sync.WaitGroup
+	members := make([]*User, 10)
+	joined := make([]bool, 10)
+	posts := make([]*Post, 10)
+	for i := range members {
+		member, _ := e.RegisterUser(fmt.Sprintf("member%d", i))
+		members[i] = member
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			joined[i] = e.JoinSubReddit(member, "source") == nil
+			posts[i], _ = e.CreatePost(member, "source", fmt.Sprintf("post %d", i))
+		}(i)
+	}
+	if err := e.MergeSubReddits(admin, "source", "dest"); err != nil {
+		t.Fatalf("MergeSubReddits: %v", err)
+	}
+	wg.Wait()
+	for i, member := range members {
+		if _, inDest := dest.Users[member.ID]; joined[i] && !inDest {
+			t.Fatalf("%s joined source but is not in dest", member.Username)
+		}
+		if post := posts[i]; post != nil && post.SubReddit != dest.Name {
+			t.Fatalf("post %d landed in a merged subreddit", post.ID)
+		}
+	}
+
+	// A writer holding a pointer from before the merge must be turned away.
+	if err := e.JoinSubReddit(user, "source"); err != ErrSubRedditNotFound {
+		t.Fatalf("JoinSubReddit after merge = %v, want ErrSubRedditNotFound", err)
+	}
+	if _, err := e.insertPost(source, user, 0, &Post{Content: "late"}); err != ErrSubRedditNotFound {
+		t.Fatalf("insertPost into a merged subreddit = %v, want ErrSubRedditNotFound", err)
+	}
+}
+
+func TestMergeSubRedditsQueuesMembersForPrivateDest(t *testing.T) {
+	e := NewEngine()
+	admin, _ := e.RegisterUser("admin")
+	member, _ := e.RegisterUser("member")
+	e.CreateSubReddit(admin, "source")
+	e.JoinSubReddit(member, "source")
+	dest := e.CreateSubReddit(admin, "dest")
+	dest.Private = true
+
+	if err := e.MergeSubReddits(admin, "source", "dest"); err != nil {
+		t.Fatalf("MergeSubReddits: %v", err)
+	}
+	if _, ok := dest.Users[member.ID]; ok {
+		t.Fatal("member joined a private dest without approval")
+	}
+	if pendingIndex(dest, member.ID) < 0 {
+		t.Fatal("member was not queued for approval")
+	}
+}
+
+func TestCreatorBecomesModerator(t *testing.T) {
+	e := NewEngine()
+	creator, _ := e.RegisterUser("creator")
+	other, _ := e.RegisterUser("other")
+	e.CreateSubReddit(creator, "sub")
+
+	if !e.IsModerator("sub", creator.ID) {
+		t.Fatal("creator is not a moderator")
+	}
+	if e.IsModerator("sub", other.ID) {
+		t.Fatal("non-creator is a moderator")
+	}
+	if e.IsModerator("missing", creator.ID) {
+		t.Fatal("IsModerator is true for a missing subreddit")
+	}
+}
+
+func TestAddAndRemoveModerators(t *testing.T) {
+	e := NewEngine()
+	creator, _ := e.RegisterUser("creator")
+	helper, _ := e.RegisterUser("helper")
+	outsider, _ := e.RegisterUser("outsider")
+	e.CreateSubReddit(creator, "sub")
+
+	if err := e.AddModerator(outsider, helper, "sub"); err != ErrNotAuthorized {
+		t.Fatalf("AddModerator by outsider = %v, want ErrNotAuthorized", err)
+	}
+	if err := e.AddModerator(creator, helper, "sub"); err != nil {
+		t.Fatalf("AddModerator: %v", err)
+	}
+	if !e.IsModerator("sub", helper.ID) {
+		t.Fatal("added moderator is not a moderator")
+	}
+	if err := e.RemoveModerator(creator, helper, "sub"); err != nil {
+		t.Fatalf("RemoveModerator: %v", err)
+	}
+	if e.IsModerator("sub", helper.ID) {
+		t.Fatal("removed moderator is still a moderator")
+	}
+}
+
+func TestRemovePostByModerator(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	author, _ := e.RegisterUser("author")
+	voter, _ := e.RegisterUser("voter")
+	e.CreateSubReddit(mod, "sub")
+	post, _ := e.CreatePost(author, "sub", "post")
+	e.UpvotePost(voter, post)
+	e.UpvotePost(mod, post)
+
+	if err := e.RemovePost(mod, "sub", post.ID); err != nil {
+		t.Fatalf("RemovePost: %v", err)
+	}
+	if count, _ := e.PostCount("sub"); count != 0 {
+		t.Fatalf("subreddit has %d posts, want 0", count)
+	}
+	if e.TotalPosts.Load() != 0 {
+		t.Fatalf("TotalPosts = %d, want 0", e.TotalPosts.Load())
+	}
+	if author.Karma != 0 {
+		t.Fatalf("author karma = %d, want 0 after removal", author.Karma)
+	}
+	if err := e.RemovePost(mod, "sub", post.ID); err != ErrPostNotFound {
+		t.Fatalf("second RemovePost = %v, want ErrPostNotFound", err)
+	}
+}
+
+func TestRemovePostRequiresModerator(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	author, _ := e.RegisterUser("author")
+	e.CreateSubReddit(mod, "sub")
+	post, _ := e.CreatePost(author, "sub", "post")
+
+	if err := e.RemovePost(author, "sub", post.ID); err != ErrNotAuthorized {
+		t.Fatalf("RemovePost by non-moderator = %v, want ErrNotAuthorized", err)
+	}
+	if count, _ := e.PostCount("sub"); count != 1 {
+		t.Fatalf("subreddit has %d posts, want 1", count)
+	}
+}
+
+func TestBanAndUnban(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	troll, _ := e.RegisterUser("troll")
+	e.CreateSubReddit(mod, "sub")
+	e.JoinSubReddit(troll, "sub")
+
+	if err := e.BanUser(troll, mod, "sub"); err != ErrNotAuthorized {
+		t.Fatalf("BanUser by non-moderator = %v, want ErrNotAuthorized", err)
+	}
+	if err := e.BanUser(mod, troll, "sub"); err != nil {
+		t.Fatalf("BanUser: %v", err)
+	}
+	if count, _ := e.SubscriberCount("sub"); count != 1 {
+		t.Fatalf("subscribers = %d, want only the moderator", count)
+	}
+	if err := e.JoinSubReddit(troll, "sub"); err != ErrBanned {
+		t.Fatalf("JoinSubReddit while banned = %v, want ErrBanned", err)
+	}
+	if _, err := e.CreatePost(troll, "sub", "spam"); err != ErrBanned {
+		t.Fatalf("CreatePost while banned = %v, want ErrBanned", err)
+	}
+
+	if err := e.UnbanUser(mod, troll, "sub"); err != nil {
+		t.Fatalf("UnbanUser: %v", err)
+	}
+	if err := e.JoinSubReddit(troll, "sub"); err != nil {
+		t.Fatalf("JoinSubReddit after unban = %v, want nil", err)
+	}
+}
+
+func TestPublicJoinIsImmediate(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	subReddit := e.CreateSubReddit(nil, "sub")
+	if err := e.JoinSubReddit(user, "sub"); err != nil {
+		t.Fatalf("JoinSubReddit = %v, want nil", err)
+	}
+	if _, member := subReddit.Users[user.ID]; !member {
+		t.Fatal("user did not join a public subreddit")
+	}
+}
+
+func TestPrivateJoinApproval(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	user, _ := e.RegisterUser("user")
+	subReddit := e.CreateSubReddit(mod, "sub")
+	subReddit.Private = true
+
+	if err := e.JoinSubReddit(user, "sub"); err != ErrJoinPending {
+		t.Fatalf("JoinSubReddit = %v, want ErrJoinPending", err)
+	}
+	if _, member := subReddit.Users[user.ID]; member {
+		t.Fatal("user joined a private subreddit without approval")
+	}
+	if err := e.ApproveJoinRequest(user, user, "sub"); err != ErrNotAuthorized {
+		t.Fatalf("self-approval = %v, want ErrNotAuthorized", err)
+	}
+	if err := e.ApproveJoinRequest(mod, user, "sub"); err != nil {
+		t.Fatalf("ApproveJoinRequest: %v", err)
+	}
+	if _, member := subReddit.Users[user.ID]; !member {
+		t.Fatal("approved user is not a member")
+	}
+	if len(subReddit.PendingRequests) != 0 {
+		t.Fatalf("%d requests still pending", len(subReddit.PendingRequests))
+	}
+}
+
+func TestPrivateJoinDenial(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	user, _ := e.RegisterUser("user")
+	subReddit := e.CreateSubReddit(mod, "sub")
+	subReddit.Private = true
+	e.JoinSubReddit(user, "sub")
+
+	if err := e.DenyJoinRequest(mod, user, "sub"); err != nil {
+		t.Fatalf("DenyJoinRequest: %v", err)
+	}
+	if _, member := subReddit.Users[user.ID]; member {
+		t.Fatal("denied user is a member")
+	}
+	if err := e.ApproveJoinRequest(mod, user, "sub"); err != ErrNoJoinRequest {
+		t.Fatalf("ApproveJoinRequest after denial = %v, want ErrNoJoinRequest", err)
+	}
+}
+
+func TestDeletePostWithoutCommentsRemovesIt(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	author, _ := e.RegisterUser("author")
+	stranger, _ := e.RegisterUser("stranger")
+	sub := e.CreateSubReddit(mod, "sub")
+	post, _ := e.CreatePost(author, "sub", "lonely")
+	kept, _ := e.CreatePost(author, "sub", "kept")
+
+	if err := e.DeletePost(stranger, post.ID); err != ErrNotAuthorized {
+		t.Fatalf("DeletePost by a stranger = %v, want ErrNotAuthorized", err)
+	}
+	if err := e.DeletePost(author, post.ID); err != nil {
+		t.Fatalf("DeletePost: %v", err)
+	}
+	if _, ok := e.GetPost(post.ID); ok {
+		t.Fatal("deleted post is still indexed")
+	}
+	if len(sub.Posts) != 1 || sub.Posts[0] != kept {
+		t.Fatalf("subreddit posts = %v, want only %d", postIDs(sub.Posts), kept.ID)
+	}
+	if err := e.DeletePost(author, post.ID); err != ErrPostNotFound {
+		t.Fatalf("deleting twice = %v, want ErrPostNotFound", err)
+	}
+	if err := e.DeletePost(mod, kept.ID); err != nil {
+		t.Fatalf("DeletePost by a moderator: %v", err)
+	}
+}
+
+func TestDeletePostWithCommentsKeepsThread(t *testing.T) {
+	e := NewEngine()
+	author, _ := e.RegisterUser("author")
+	commenter, _ := e.RegisterUser("commenter")
+	sub := e.CreateSubReddit(author, "sub")
+	post, _ := e.CreatePost(author, "sub", "discussion")
+	comment, _ := e.CommentPost(commenter, post, "reply")
+	reply, _ := e.AddReplyToComment(author, comment, "nested")
+
+	if err := e.DeletePost(author, post.ID); err != nil {
+		t.Fatalf("DeletePost: %v", err)
+	}
+	stored, ok := e.GetPost(post.ID)
+	if !ok || len(sub.Posts) != 1 {
+		t.Fatal("post with comments was removed")
+	}
+	if stored.Content != "[deleted]" || stored.Author != e.DeletedUser {
+		t.Fatalf("soft-deleted post = %q by %q", stored.Content, stored.Author.Username)
+	}
+	if got, ok := e.GetComment(post.ID, reply.ID); !ok || got.Content != "nested" || got.Author != author {
+		t.Fatal("thread under the deleted post was lost")
+	}
+}
+
+func TestSubRedditInfo(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	member, _ := e.RegisterUser("member")
+	e.CreateSubReddit(mod, "sub")
+	e.JoinSubReddit(member, "sub")
+	rules := []string{"be kind", "no spam"}
+
+	if err := e.SetSubRedditInfo(mod, "sub", "a test community", rules); err != nil {
+		t.Fatalf("SetSubRedditInfo: %v", err)
+	}
+	rules[0] = "changed by the caller"
+	if err := e.SetSubRedditInfo(member, "sub", "hijacked", nil); err != ErrNotAuthorized {
+		t.Fatalf("SetSubRedditInfo by a member = %v, want ErrNotAuthorized", err)
+	}
+
+	description, got, err := e.GetSubRedditInfo("SUB")
+	if err != nil {
+		t.Fatalf("GetSubRedditInfo: %v", err)
+	}
+	if description != "a test community" || fmt.Sprint(got) != "[be kind no spam]" {
+		t.Fatalf("info = %q, %q", description, got)
+	}
+	got[1] = "changed by a reader"
+	if _, again, _ := e.GetSubRedditInfo("sub"); again[1] != "no spam" {
+		t.Fatal("GetSubRedditInfo exposed the stored rules")
+	}
+	if _, _, err := e.GetSubRedditInfo("missing"); err != ErrSubRedditNotFound {
+		t.Fatalf("GetSubRedditInfo(missing) = %v, want ErrSubRedditNotFound", err)
+	}
+}
+
+func TestModLogRecordsBanAndRemoval(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	mod, _ := e.RegisterUser("mod")
+	second, _ := e.RegisterUser("second")
+	troll, _ := e.RegisterUser("troll")
+	e.CreateSubReddit(mod, "sub")
+	e.AddModerator(mod, second, "sub")
+	post, _ := e.CreatePost(troll, "sub", "spam")
+	start, _ := e.GetModLog(mod, "sub")
+
+	*now = now.Add(time.Minute)
+	e.BanUser(mod, troll, "sub")
+	*now = now.Add(time.Minute)
+	e.RemovePost(second, "sub", post.ID)
+
+	log, err := e.GetModLog(mod, "sub")
+	if err != nil {
+		t.Fatalf("GetModLog: %v", err)
+	}
+	want := []ModAction{
+		{Type: ActivityBan, ModeratorID: mod.ID, TargetID: troll.ID, Timestamp: testEpoch.Add(time.Minute)},
+		{Type: ActivityRemovePost, ModeratorID: second.ID, TargetID: post.ID, Timestamp: testEpoch.Add(2 * time.Minute)},
+	}
+	got := log[len(start):]
+	if len(got) != len(want) {
+		t.Fatalf("mod log gained %d entries, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if _, err := e.GetModLog(troll, "sub"); err != ErrNotAuthorized {
+		t.Fatalf("GetModLog by a non-moderator = %v, want ErrNotAuthorized", err)
+	}
+}
+
+func TestLockedPostRejectsComments(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(mod, "sub")
+	post, _ := e.CreatePost(user, "sub", "heated")
+	comment, _ := e.CommentPost(user, post, "before the lock")
+
+	if err := e.LockPost(user, post.ID); err != ErrNotAuthorized {
+		t.Fatalf("LockPost by a non-moderator = %v, want ErrNotAuthorized", err)
+	}
+	if err := e.LockPost(mod, post.ID); err != nil {
+		t.Fatalf("LockPost: %v", err)
+	}
+	if _, err := e.CommentPost(user, post, "while locked"); err != ErrPostLocked {
+		t.Fatalf("CommentPost on a locked post = %v, want ErrPostLocked", err)
+	}
+	if _, err := e.AddReplyToComment(user, comment, "while locked"); err != ErrPostLocked {
+		t.Fatalf("AddReplyToComment on a locked post = %v, want ErrPostLocked", err)
+	}
+	if post.CommentCount != 1 {
+		t.Fatalf("CommentCount = %d after rejected comments", post.CommentCount)
+	}
+
+	if err := e.UnlockPost(mod, post.ID); err != nil {
+		t.Fatalf("UnlockPost: %v", err)
+	}
+	if _, err := e.CommentPost(user, post, "after unlock"); err != nil {
+		t.Fatalf("CommentPost after unlock: %v", err)
+	}
+	if _, err := e.AddReplyToComment(user, comment, "after unlock"); err != nil {
+		t.Fatalf("AddReplyToComment after unlock: %v", err)
+	}
+}
+
+func TestPinnedPostsLeadSubRedditFeed(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	voter, _ := e.RegisterUser("voter")
+	e.CreateSubReddit(mod, "sub")
+	e.MaxPinnedPosts = 1
+	announcement, _ := e.CreatePost(mod, "sub", "announcement")
+	e.DownvotePost(voter, announcement)
+	popular, _ := e.CreatePost(mod, "sub", "popular")
+	e.UpvotePost(voter, popular)
+
+	if err := e.PinPost(voter, announcement.ID); err != ErrNotAuthorized {
+		t.Fatalf("PinPost by a non-moderator = %v, want ErrNotAuthorized", err)
+	}
+	if err := e.PinPost(mod, announcement.ID); err != nil {
+		t.Fatalf("PinPost: %v", err)
+	}
+	for _, mode := range []string{"hot", "new", "top"} {
+		feed, _ := e.GetSubRedditFeed("sub", mode)
+		if len(feed) != 2 || feed[0] != announcement {
+			t.Errorf("%s feed = %v, want pinned post %d first", mode, postIDs(feed), announcement.ID)
+		}
+	}
+	if err := e.PinPost(mod, popular.ID); err != ErrTooManyPinned {
+		t.Fatalf("pinning past the limit = %v, want ErrTooManyPinned", err)
+	}
+
+	if err := e.UnpinPost(mod, announcement.ID); err != nil {
+		t.Fatalf("UnpinPost: %v", err)
+	}
+	if feed, _ := e.GetSubRedditFeed("sub", "top"); feed[0] != popular {
+		t.Fatalf("top feed after unpinning = %v", postIDs(feed))
+	}
+}
+
+func TestRemoveCommentKeepsRepliesAndReversesKarma(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	author, _ := e.RegisterUser("author")
+	replier, _ := e.RegisterUser("replier")
+	e.CreateSubReddit(mod, "sub")
+	post, _ := e.CreatePost(mod, "sub", "post")
+	comment, _ := e.CommentPost(author, post, "rude")
+	reply, _ := e.AddReplyToComment(replier, comment, "calm down")
+	for i := 0; i < 3; i++ {
+		e.UpvoteComment(comment)
+	}
+	e.UpvoteComment(reply)
+
+	if err := e.RemoveComment(author, post.ID, comment.ID); err != ErrNotAuthorized {
+		t.Fatalf("RemoveComment by a non-moderator = %v, want ErrNotAuthorized", err)
+	}
+	if err := e.RemoveComment(mod, post.ID, comment.ID); err != nil {
+		t.Fatalf("RemoveComment: %v", err)
+	}
+	if comment.Content != "[removed]" || !comment.Removed || comment.Score() != 0 {
+		t.Fatalf("removed comment = %+v", comment)
+	}
+	if len(comment.Replies) != 1 || comment.Replies[0] != reply || reply.Content != "calm down" {
+		t.Fatal("replies to the removed comment were lost")
+	}
+	if author.Karma != 0 || author.CommentKarma != 0 || e.GetSubRedditKarma(author, "sub") != 0 {
+		t.Fatalf("author karma after removal = %d (comment %d)", author.Karma, author.CommentKarma)
+	}
+	if replier.CommentKarma != 1 {
+		t.Fatalf("replier's karma = %d, want 1", replier.CommentKarma)
+	}
+	if err := e.RemoveComment(mod, post.ID, reply.ID+1); err != ErrCommentNotFound {
+		t.Fatalf("RemoveComment of a missing comment = %v, want ErrCommentNotFound", err)
+	}
+}
+
+func TestVotesOnRemovedCommentAreIgnored(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	author, _ := e.RegisterUser("author")
+	e.CreateSubReddit(mod, "sub")
+	post, _ := e.CreatePost(mod, "sub", "post")
+	comment, _ := e.CommentPost(author, post, "rude")
+	e.RemoveComment(mod, post.ID, comment.ID)
+	votes := e.TotalVotes.Load()
+
+	e.UpvoteComment(comment)
+	e.UpvoteComment(comment)
+	e.DownvoteComment(comment)
+	if comment.Score() != 0 || comment.Upvotes != 0 || comment.Downvotes != 0 {
+		t.Fatalf("removed comment collected votes: +%d -%d", comment.Upvotes, comment.Downvotes)
+	}
+	if author.CommentKarma != 0 || e.GetSubRedditKarma(author, "sub") != 0 {
+		t.Fatalf("author earned karma from a removed comment: %d", author.CommentKarma)
+	}
+	if got := e.TotalVotes.Load(); got != votes {
+		t.Fatalf("TotalVotes = %d, want %d", got, votes)
+	}
+}
+
+func TestReportsLandInTheirSubRedditQueue(t *testing.T) {
+	e := NewEngine()
+	setClock(e, testEpoch)
+	mod, _ := e.RegisterUser("mod")
+	otherMod, _ := e.RegisterUser("othermod")
+	reporter, _ := e.RegisterUser("reporter")
+	e.CreateSubReddit(mod, "sub")
+	e.CreateSubReddit(otherMod, "other")
+	post, _ := e.CreatePost(reporter, "sub", "questionable")
+
+	if err := e.ReportPost(reporter, post.ID, "spam"); err != nil {
+		t.Fatalf("ReportPost: %v", err)
+	}
+	reports, err := e.GetReports(mod, "sub")
+	if err != nil {
+		t.Fatalf("GetReports: %v", err)
+	}
+	want := Report{ReporterID: reporter.ID, PostID: post.ID, Reason: "spam", CreatedAt: testEpoch}
+	if len(reports) != 1 || reports[0] != want {
+		t.Fatalf("reports = %+v, want [%+v]", reports, want)
+	}
+	if other, _ := e.GetReports(otherMod, "other"); len(other) != 0 {
+		t.Fatalf("report leaked into another subreddit: %+v", other)
+	}
+	if _, err := e.GetReports(reporter, "sub"); err != ErrNotAuthorized {
+		t.Fatalf("GetReports by a non-moderator = %v, want ErrNotAuthorized", err)
+	}
+	if _, err := e.GetReports(otherMod, "sub"); err != ErrNotAuthorized {
+		t.Fatalf("GetReports by another subreddit's moderator = %v, want ErrNotAuthorized", err)
+	}
+	if err := e.ReportPost(reporter, post.ID+1, "missing"); err != ErrPostNotFound {
+		t.Fatalf("ReportPost of a missing post = %v, want ErrPostNotFound", err)
+	}
+	if got := e.TotalReports.Load(); got != 1 {
+		t.Fatalf("TotalReports = %d, want 1", got)
+	}
+}
+
+func TestReportCommentRecordsTheComment(t *testing.T) {
+	e := NewEngine()
+	setClock(e, testEpoch)
+	mod, _ := e.RegisterUser("mod")
+	reporter, _ := e.RegisterUser("reporter")
+	e.CreateSubReddit(mod, "sub")
+	post, _ := e.CreatePost(mod, "sub", "post")
+	comment, _ := e.CommentPost(mod, post, "questionable")
+
+	if err := e.ReportComment(reporter, post.ID, comment.ID, "rude"); err != nil {
+		t.Fatalf("ReportComment: %v", err)
+	}
+	reports, _ := e.GetReports(mod, "sub")
+	want := Report{ReporterID: reporter.ID, PostID: post.ID, CommentID: comment.ID, Reason: "rude", CreatedAt: testEpoch}
+	if len(reports) != 1 || reports[0] != want {
+		t.Fatalf("reports = %+v, want [%+v]", reports, want)
+	}
+	if err := e.ReportComment(reporter, post.ID, comment.ID+1, "missing"); err != ErrCommentNotFound {
+		t.Fatalf("ReportComment of a missing comment = %v, want ErrCommentNotFound", err)
+	}
+	if err := e.ReportComment(reporter, post.ID+1, comment.ID, "missing"); err != ErrPostNotFound {
+		t.Fatalf("ReportComment on a missing post = %v, want ErrPostNotFound", err)
+	}
+}
+
+func TestReportsDuringMergeReachDest(t *testing.T) {
+	e := NewEngine()
+	admin, _ := e.RegisterUser("admin")
+	reporter, _ := e.RegisterUser("reporter")
+	e.CreateSubReddit(admin, "source")
+	e.CreateSubReddit(admin, "dest")
+	post, _ := e.CreatePost(admin, "source", "post")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.ReportPost(reporter, post.ID, "spam")
+		}()
+	}
+	if err := e.MergeSubReddits(admin, "source", "dest"); err != nil {
+		t.Fatalf("MergeSubReddits: %v", err)
+	}
+	wg.Wait()
+	reports, _ := e.GetReports(admin, "dest")
+	if got := int64(len(reports)); got != e.TotalReports.Load() {
+		t.Fatalf("dest holds %d reports, %d were filed", got, e.TotalReports.Load())
+	}
+}
+
+func TestMergeSubRedditsMovesPosts(t *testing.T) {
+	e := NewEngine()
+	admin, _ := e.RegisterUser("admin")
+	member, _ := e.RegisterUser("member")
+	outsider, _ := e.RegisterUser("outsider")
+	e.CreateSubReddit(admin, "source")
+	dest := e.CreateSubReddit(admin, "dest")
+	e.JoinSubReddit(member, "source")
+	moved, _ := e.CreatePost(member, "source", "moved")
+	kept, _ := e.CreatePost(admin, "dest", "kept")
+	total := e.TotalPosts.Load()
+
+	if err := e.MergeSubReddits(admin, "Source", "source"); err != ErrSameSubReddit {
+		t.Fatalf("merging into itself = %v, want ErrSameSubReddit", err)
+	}
+	if err := e.MergeSubReddits(outsider, "source", "dest"); err != ErrNotAuthorized {
+		t.Fatalf("merge by a non-moderator = %v, want ErrNotAuthorized", err)
+	}
+	if err := e.MergeSubReddits(admin, "source", "missing"); err != ErrSubRedditNotFound {
+		t.Fatalf("merge into a missing subreddit = %v, want ErrSubRedditNotFound", err)
+	}
+	if err := e.MergeSubReddits(admin, "source", "dest"); err != nil {
+		t.Fatalf("MergeSubReddits: %v", err)
+	}
+
+	if _, exists := e.GetSubReddit("source"); exists {
+		t.Fatal("source still exists")
+	}
+	if got := postIDs(dest.Posts); fmt.Sprint(got) != fmt.Sprint([]int{kept.ID, moved.ID}) {
+		t.Fatalf("dest posts = %v, want %d then %d", got, kept.ID, moved.ID)
+	}
+	if indexed, ok := e.GetPost(moved.ID); !ok || indexed.SubReddit != dest.Name {
+		t.Fatalf("moved post index entry = %+v", indexed)
+	}
+	if _, ok := dest.Users[member.ID]; !ok {
+		t.Fatal("source member did not join dest")
+	}
+	if got := e.TotalPosts.Load(); got != total {
+		t.Fatalf("TotalPosts = %d after merging, want %d", got, total)
+	}
+	if count, _ := e.PostCount("dest"); count != 2 {
+		t.Fatalf("PostCount(dest) = %d, want 2", count)
+	}
+}
+
+func TestBanDiscardsPendingJoinRequest(t *testing.T) {
+	e := NewEngine()
+	mod, _ := e.RegisterUser("mod")
+	user, _ := e.RegisterUser("user")
+	subReddit := e.CreateSubReddit(mod, "sub")
+	subReddit.Private = true
+	e.JoinSubReddit(user, "sub")
+
+	if err := e.BanUser(mod, user, "sub"); err != nil {
+		t.Fatalf("BanUser: %v", err)
+	}
+	if len(subReddit.PendingRequests) != 0 {
+		t.Fatalf("%d requests still pending after the ban", len(subReddit.PendingRequests))
+	}
+	if err := e.ApproveJoinRequest(mod, user, "sub"); err != ErrNoJoinRequest {
+		t.Fatalf("ApproveJoinRequest after ban = %v, want ErrNoJoinRequest", err)
+	}
+
+	// A request that predates the ban, e.g. from an older save, is still
+	// refused.
+	subReddit.PendingRequests = append(subReddit.PendingRequests, user)
+	if err := e.ApproveJoinRequest(mod, user, "sub"); err != ErrBanned {
+		t.Fatalf("ApproveJoinRequest for a banned user = %v, want ErrBanned", err)
+	}
+	if _, member := subReddit.Users[user.ID]; member {
+		t.Fatal("banned user was approved into the subreddit")
+	}
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type NotificationType string
+
+const (
+	NotifyPostReply    NotificationType = "post_reply"
+	NotifyCommentReply NotificationType = "comment_reply"
+	NotifyMessage      NotificationType = "message"
+	NotifyMention      NotificationType = "mention"
+)
+
+type Notification struct {
+	Type      NotificationType
+	FromUser  *User
+	PostID    int
+	CommentID int
+	CreatedAt time.Time
+	Read      bool
+}
+
+// notify queues n for the user. Nobody is notified about their own actions
+// or by users they have blocked, and the deleted-user sentinel never
+// collects notifications. Callers must hold e.Mutex.
+func (e *Engine) notify(to *User, n Notification) {
+	if to == nil || to == e.DeletedUser || (n.FromUser != nil && n.FromUser.ID == to.ID) || hasBlocked(to, n.FromUser) {
+		return
+	}
+	n.CreatedAt = e.now()
+	e.Notifications[to.ID] = append(e.Notifications[to.ID], n)
+}
+
+func (e *Engine) GetNotifications(user *User) []Notification {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	return append([]Notification{}, e.Notifications[user.ID]...)
+}
+
+func (e *Engine) MarkNotificationsRead(user *User) {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	for i := range e.Notifications[user.ID] {
+		e.Notifications[user.ID][i].Read = true
+	}
+	e.logActivity(ActivityReadNotifications, user.ID, 0, "")
+}
+
+// parseMentions returns the distinct names referenced as @name in content,
+// ignoring surrounding punctuation.
+func parseMentions(content string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, token := range strings.Fields(content) {
+		if !strings.HasPrefix(token, "@") {
+			continue
+		}
+		name := strings.TrimRightFunc(token[1:], func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-'
+		})
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// notifyMentions sends one mention notification to each known user named in
+// content. Callers must hold e.Mutex.
+func (e *Engine) notifyMentions(from *User, content string, postID, commentID int) {
+	for _, name := range parseMentions(content) {
+		if user, exists := e.userByName(name); exists {
+			e.notify(user, Notification{Type: NotifyMention, FromUser: from, PostID: postID, CommentID: commentID})
+		}
+	}
+}
+
+type InboxItemType string
+
+const (
+	InboxMessage      InboxItemType = "message"
+	InboxNotification InboxItemType = "notification"
+)
+
+// InboxItem is one entry in a user's inbox. Exactly one of Message and
+// Notification is set, as indicated by Type.
+type InboxItem struct {
+	Type         InboxItemType
+	Message      *Message
+	Notification *Notification
+	Timestamp    time.Time
+}
+
+// GetInbox merges the user's direct messages and notifications, newest first.
+// Message notifications are left out since the message itself is listed, and
+// anything from a user they have since blocked is hidden.
+func (e *Engine) GetInbox(user *User) []InboxItem {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	inbox := []InboxItem{}
+	for _, message := range e.Messages {
+		if addressedTo(message, user) && !hasBlocked(user, message.From) {
+			inbox = append(inbox, InboxItem{Type: InboxMessage, Message: &message, Timestamp: message.SentAt})
+		}
+	}
+	for _, n := range e.Notifications[user.ID] {
+		if n.Type == NotifyMessage || hasBlocked(user, n.FromUser) {
+			continue
+		}
+		inbox = append(inbox, InboxItem{Type: InboxNotification, Notification: &n, Timestamp: n.CreatedAt})
+	}
+	sort.SliceStable(inbox, func(i, j int) bool {
+		return inbox[i].Timestamp.After(inbox[j].Timestamp)
+	})
+	return inbox
+}
@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestReplyNotifiesParentAuthorOnly(t *testing.T) {
+	e := NewEngine()
+	setClock(e, testEpoch)
+	op, _ := e.RegisterUser("op")
+	commenter, _ := e.RegisterUser("commenter")
+	replier, _ := e.RegisterUser("replier")
+	e.CreateSubReddit(op, "sub")
+	post, _ := e.CreatePost(op, "sub", "post")
+
+	comment, _ := e.CommentPost(commenter, post, "top-level")
+	reply, _ := e.AddReplyToComment(replier, comment, "reply")
+	e.AddReplyToComment(replier, reply, "replying to myself")
+
+	opNotes := e.GetNotifications(op)
+	if len(opNotes) != 1 || opNotes[0].Type != NotifyPostReply || opNotes[0].FromUser != commenter ||
+		opNotes[0].PostID != post.ID || opNotes[0].CommentID != comment.ID || !opNotes[0].CreatedAt.Equal(testEpoch) {
+		t.Fatalf("post author's notifications = %+v", opNotes)
+	}
+	commenterNotes := e.GetNotifications(commenter)
+	if len(commenterNotes) != 1 || commenterNotes[0].Type != NotifyCommentReply ||
+		commenterNotes[0].FromUser != replier || commenterNotes[0].CommentID != reply.ID {
+		t.Fatalf("parent comment author's notifications = %+v", commenterNotes)
+	}
+	if got := e.GetNotifications(replier); len(got) != 0 {
+		t.Fatalf("replier was notified about their own replies: %+v", got)
+	}
+
+	e.SendDirectMessage(replier, op, "hi")
+	opNotes = e.GetNotifications(op)
+	if len(opNotes) != 2 || opNotes[1].Type != NotifyMessage || opNotes[1].FromUser != replier {
+		t.Fatalf("message notification missing: %+v", opNotes)
+	}
+	e.MarkNotificationsRead(op)
+	for _, n := range e.GetNotifications(op) {
+		if !n.Read {
+			t.Fatalf("notification %+v still unread", n)
+		}
+	}
+}
+
+func TestMentionsNotifyKnownUsersOnce(t *testing.T) {
+	e := NewEngine()
+	author, _ := e.RegisterUser("author")
+	alice, _ := e.RegisterUser("alice")
+	bob, _ := e.RegisterUser("bob")
+	e.CreateSubReddit(author, "sub")
+
+	post, _ := e.CreatePost(author, "sub", "thanks @alice, @Alice and @alice! cc @nobody")
+	comment, _ := e.CommentPost(author, post, "@bob what do you think?")
+
+	aliceNotes := e.GetNotifications(alice)
+	if len(aliceNotes) != 1 || aliceNotes[0].Type != NotifyMention || aliceNotes[0].FromUser != author || aliceNotes[0].PostID != post.ID {
+		t.Fatalf("alice's notifications = %+v, want one mention", aliceNotes)
+	}
+	bobNotes := e.GetNotifications(bob)
+	if len(bobNotes) != 1 || bobNotes[0].Type != NotifyMention || bobNotes[0].CommentID != comment.ID {
+		t.Fatalf("bob's notifications = %+v, want one comment mention", bobNotes)
+	}
+	if got := e.GetNotifications(author); len(got) != 0 {
+		t.Fatalf("author was notified: %+v", got)
+	}
+}
+
+func TestGetInboxMergesNewestFirst(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	user, _ := e.RegisterUser("user")
+	friend, _ := e.RegisterUser("friend")
+	e.CreateSubReddit(user, "sub")
+	post, _ := e.CreatePost(user, "sub", "post")
+	step := func() { *now = now.Add(time.Minute) }
+
+	step()
+	e.SendDirectMessage(friend, user, "first message")
+	step()
+	e.CommentPost(friend, post, "a reply")
+	step()
+	e.SendDirectMessage(friend, user, "second message")
+	step()
+	e.CommentPost(friend, post, "mentioning @user")
+	step()
+	e.SendDirectMessage(user, friend, "outgoing")
+
+	var got []string
+	for _, item := range e.GetInbox(user) {
+		switch item.Type {
+		case InboxMessage:
+			got = append(got, "message:"+item.Message.Content)
+		case InboxNotification:
+			got = append(got, "notification:"+string(item.Notification.Type))
+		}
+	}
+	want := []string{
+		"notification:" + string(NotifyPostReply),
+		"notification:" + string(NotifyMention),
+		"message:second message",
+		"notification:" + string(NotifyPostReply),
+		"message:first message",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("inbox = %v\nwant    %v", got, want)
+	}
+}
+
+func TestBlockedUsersCannotNotify(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	troll, _ := e.RegisterUser("troll")
+	friend, _ := e.RegisterUser("friend")
+	e.CreateSubReddit(user, "sub")
+	post, _ := e.CreatePost(user, "sub", "post")
+	comment, _ := e.CommentPost(user, post, "comment")
+	e.SendDirectMessage(troll, user, "before the block")
+	e.CommentPost(troll, post, "also before the block")
+
+	e.BlockUser(user, troll)
+	e.AddReplyToComment(troll, comment, "reply")
+	e.CommentPost(troll, post, "hey @user")
+	e.CommentPost(friend, post, "a friendly reply")
+
+	notifications := e.GetNotifications(user)
+	if len(notifications) != 3 {
+		t.Fatalf("%d notifications, want the two from before the block and the friend's reply", len(notifications))
+	}
+	for _, n := range notifications[2:] {
+		if n.FromUser == troll {
+			t.Fatalf("blocked user's %s notification was delivered", n.Type)
+		}
+	}
+	if got := e.UnreadCount(user); got != 0 {
+		t.Fatalf("UnreadCount = %d; a blocked sender's message should not count", got)
+	}
+	for _, item := range e.GetInbox(user) {
+		if item.Type == InboxMessage || item.Notification.FromUser == troll {
+			t.Fatalf("inbox shows %+v from the blocked user", item)
+		}
+	}
+	if inbox := e.GetInbox(user); len(inbox) != 1 || inbox[0].Notification.FromUser != friend {
+		t.Fatalf("inbox has %d items, want only the friend's reply", len(inbox))
+	}
+}
@@ -0,0 +1,537 @@
+package engine
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The saved* types mirror the engine's data structures with every *User
+// replaced by its ID, so the object graph can round-trip through JSON.
+
+type savedUser struct {
+	ID           int
+	Username     string
+	Karma        int
+	PostKarma    int
+	CommentKarma int
+	Actions      int64
+	Connected    bool
+	Blocked      []int
+	Saved        []int
+	ShowNSFW     bool
+	CreatedAt    time.Time
+
+	SubRedditKarma map[string]int
+}
+
+type savedComment struct {
+	ID        int
+	AuthorID  int
+	Content   string
+	Replies   []savedComment
+	Upvotes   int
+	Downvotes int
+	CreatedAt time.Time
+	Awards    []Award
+	Edited    bool
+	EditedAt  time.Time
+	Removed   bool
+}
+
+type savedPost struct {
+	ID             int
+	AuthorID       int
+	Content        string
+	Comments       []savedComment
+	Upvotes        int
+	Downvotes      int
+	Voters         map[int]int
+	CreatedAt      time.Time
+	OriginalPostID int
+	IsRepost       bool
+	Awards         []Award
+	Flair          string
+	IsCrossPost    bool
+	CrossPostCount int
+	Edited         bool
+	EditedAt       time.Time
+	Locked         bool
+	Pinned         bool
+	NSFW           bool
+	VoteKarma      int
+	AwardKarma     int
+	PublishAt      time.Time
+}
+
+// savedScheduledPost is a post still waiting for PublishDuePosts. It has no
+// votes or comments yet, so only what SchedulePost set is kept.
+type savedScheduledPost struct {
+	ID        int
+	AuthorID  int
+	SubReddit string
+	Content   string
+	PublishAt time.Time
+}
+
+type savedSubReddit struct {
+	Name            string
+	DisplayName     string
+	Posts           []savedPost
+	Members         []int
+	Moderators      []int
+	Banned          []int
+	Private         bool
+	PendingRequests []int
+	RestrictPosting bool
+	MinKarmaToPost  int
+	Description     string
+	Rules           []string
+	ModLog          []ModAction
+	Reports         []Report
+}
+
+type savedMessage struct {
+	ID      int
+	FromID  int
+	ToID    int
+	Content string
+	SentAt  time.Time
+	Read    bool
+}
+
+type savedNotification struct {
+	Type      NotificationType
+	FromID    int
+	PostID    int
+	CommentID int
+	CreatedAt time.Time
+	Read      bool
+}
+
+type savedEngine struct {
+	Users             []savedUser
+	SubReddits        []savedSubReddit
+	Messages          []savedMessage
+	Notifications     map[int][]savedNotification
+	Scheduled         []savedScheduledPost
+	UserID            int
+	PostID            int
+	CommentID         int
+	MessageID         int
+	TotalPosts        int64
+	TotalVotes        int64
+	TotalUpvotes      int64
+	TotalDownvotes    int64
+	TotalMessages     int64
+	TotalActions      int64
+	TotalComments     int64
+	TotalAwards       int64
+	TotalReports      int64
+	DisconnectedUsers int64
+	StartTime         time.Time
+	ActionBreakdown   map[string]int64
+}
+
+func (e *Engine) SaveToJSON(w io.Writer) error {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+
+	saved := savedEngine{
+		Users:             []savedUser{},
+		SubReddits:        []savedSubReddit{},
+		Messages:          []savedMessage{},
+		Notifications:     make(map[int][]savedNotification),
+		Scheduled:         []savedScheduledPost{},
+		UserID:            e.UserID,
+		PostID:            int(e.PostID.Load()),
+		CommentID:         e.CommentID,
+		MessageID:         e.MessageID,
+		TotalPosts:        e.TotalPosts.Load(),
+		TotalVotes:        e.TotalVotes.Load(),
+		TotalUpvotes:      e.TotalUpvotes.Load(),
+		TotalDownvotes:    e.TotalDownvotes.Load(),
+		TotalMessages:     e.TotalMessages.Load(),
+		TotalActions:      e.TotalActions.Load(),
+		TotalComments:     e.TotalComments.Load(),
+		TotalAwards:       e.TotalAwards.Load(),
+		TotalReports:      e.TotalReports.Load(),
+		DisconnectedUsers: e.DisconnectedUsers.Load(),
+		StartTime:         e.StartTime,
+		ActionBreakdown:   make(map[string]int64),
+	}
+	for action, count := range e.ActionBreakdown {
+		saved.ActionBreakdown[action] = count.Load()
+	}
+
+	subRedditKarma := make(map[int]map[string]int)
+	for key, karma := range e.subRedditKarma {
+		if subRedditKarma[key.userID] == nil {
+			subRedditKarma[key.userID] = make(map[string]int)
+		}
+		subRedditKarma[key.userID][key.subReddit] = karma
+	}
+	for _, user := range e.Users {
+		saved.Users = append(saved.Users, savedUser{
+			ID:           user.ID,
+			Username:     user.Username,
+			Karma:        user.Karma,
+			PostKarma:    user.PostKarma,
+			CommentKarma: user.CommentKarma,
+			Actions:      user.Actions.Load(),
+			Connected:    user.Connected,
+			ShowNSFW:     user.ShowNSFW,
+			CreatedAt:    user.CreatedAt,
+			Blocked:      flaggedIDs(user.Blocked),
+			Saved:        append([]int{}, user.savedOrder...),
+
+			SubRedditKarma: subRedditKarma[user.ID],
+		})
+	}
+	sort.Slice(saved.Users, func(i, j int) bool {
+		return saved.Users[i].ID < saved.Users[j].ID
+	})
+
+	for _, subreddit := range e.SubReddits {
+		saved.SubReddits = append(saved.SubReddits, saveSubReddit(subreddit))
+	}
+	sort.Slice(saved.SubReddits, func(i, j int) bool {
+		return saved.SubReddits[i].Name < saved.SubReddits[j].Name
+	})
+
+	for _, message := range e.Messages {
+		saved.Messages = append(saved.Messages, savedMessage{
+			ID:      message.ID,
+			FromID:  userID(message.From),
+			ToID:    userID(message.To),
+			Content: message.Content,
+			SentAt:  message.SentAt,
+			Read:    message.Read,
+		})
+	}
+	for id, notifications := range e.Notifications {
+		for _, n := range notifications {
+			saved.Notifications[id] = append(saved.Notifications[id], savedNotification{
+				Type:      n.Type,
+				FromID:    userID(n.FromUser),
+				PostID:    n.PostID,
+				CommentID: n.CommentID,
+				CreatedAt: n.CreatedAt,
+				Read:      n.Read,
+			})
+		}
+	}
+	for _, post := range e.scheduled {
+		saved.Scheduled = append(saved.Scheduled, savedScheduledPost{
+			ID:        post.ID,
+			AuthorID:  userID(post.Author),
+			SubReddit: post.SubReddit,
+			Content:   post.Content,
+			PublishAt: post.PublishAt,
+		})
+	}
+
+	return json.NewEncoder(w).Encode(saved)
+}
+
+func saveSubReddit(subReddit *SubReddit) savedSubReddit {
+	subReddit.Mutex.RLock()
+	defer subReddit.Mutex.RUnlock()
+	saved := savedSubReddit{
+		Name:            subReddit.Name,
+		DisplayName:     subReddit.DisplayName,
+		Posts:           []savedPost{},
+		Members:         userIDs(subReddit.Users),
+		Moderators:      userIDs(subReddit.Moderators),
+		Banned:          flaggedIDs(subReddit.Banned),
+		Private:         subReddit.Private,
+		PendingRequests: []int{},
+		RestrictPosting: subReddit.RestrictPosting,
+		MinKarmaToPost:  subReddit.MinKarmaToPost,
+		Description:     subReddit.Description,
+		Rules:           append([]string{}, subReddit.Rules...),
+		ModLog:          append([]ModAction{}, subReddit.ModLog...),
+		Reports:         append([]Report{}, subReddit.Reports...),
+	}
+	for _, user := range subReddit.PendingRequests {
+		saved.PendingRequests = append(saved.PendingRequests, user.ID)
+	}
+	for _, post := range subReddit.Posts {
+		saved.Posts = append(saved.Posts, savedPost{
+			ID:             post.ID,
+			AuthorID:       userID(post.Author),
+			Content:        post.Content,
+			Comments:       saveComments(post.Comments),
+			Upvotes:        post.Upvotes,
+			Downvotes:      post.Downvotes,
+			Voters:         post.Voters,
+			CreatedAt:      post.CreatedAt,
+			OriginalPostID: post.OriginalPostID,
+			IsRepost:       post.IsRepost,
+			Awards:         post.Awards,
+			Flair:          post.Flair,
+			IsCrossPost:    post.IsCrossPost,
+			CrossPostCount: post.CrossPostCount,
+			Edited:         post.Edited,
+			EditedAt:       post.EditedAt,
+			Locked:         post.Locked,
+			Pinned:         post.Pinned,
+			NSFW:           post.NSFW,
+			VoteKarma:      post.voteKarma,
+			AwardKarma:     post.awardKarma,
+			PublishAt:      post.PublishAt,
+		})
+	}
+	return saved
+}
+
+func saveComments(comments []*Comment) []savedComment {
+	saved := []savedComment{}
+	for _, comment := range comments {
+		saved = append(saved, savedComment{
+			ID:        comment.ID,
+			AuthorID:  userID(comment.Author),
+			Content:   comment.Content,
+			Replies:   saveComments(comment.Replies),
+			Upvotes:   comment.Upvotes,
+			Downvotes: comment.Downvotes,
+			CreatedAt: comment.CreatedAt,
+			Awards:    comment.Awards,
+			Edited:    comment.Edited,
+			EditedAt:  comment.EditedAt,
+			Removed:   comment.Removed,
+		})
+	}
+	return saved
+}
+
+// userID maps a nil or deleted user to the sentinel's ID.
+func userID(user *User) int {
+	if user == nil {
+		return 0
+	}
+	return user.ID
+}
+
+func flaggedIDs(flags map[int]bool) []int {
+	ids := []int{}
+	for id, flagged := range flags {
+		if flagged {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func userIDs(users map[int]*User) []int {
+	ids := []int{}
+	for id := range users {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// LoadFromJSON rebuilds an engine written by SaveToJSON, rewiring every user
+// reference to the loaded User values. References to users that no longer
+// exist resolve to the engine's DeletedUser.
+func LoadFromJSON(r io.Reader) (*Engine, error) {
+	var saved savedEngine
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return nil, err
+	}
+
+	e := NewEngine()
+	e.UserID = saved.UserID
+	e.PostID.Store(int64(saved.PostID))
+	e.CommentID = saved.CommentID
+	e.MessageID = saved.MessageID
+	e.TotalPosts.Store(saved.TotalPosts)
+	e.TotalVotes.Store(saved.TotalVotes)
+	e.TotalUpvotes.Store(saved.TotalUpvotes)
+	e.TotalDownvotes.Store(saved.TotalDownvotes)
+	e.TotalMessages.Store(saved.TotalMessages)
+	e.TotalActions.Store(saved.TotalActions)
+	e.TotalComments.Store(saved.TotalComments)
+	e.TotalAwards.Store(saved.TotalAwards)
+	e.TotalReports.Store(saved.TotalReports)
+	e.DisconnectedUsers.Store(saved.DisconnectedUsers)
+	e.StartTime = saved.StartTime
+	for action, count := range saved.ActionBreakdown {
+		if counter, ok := e.ActionBreakdown[action]; ok {
+			counter.Store(count)
+		}
+	}
+
+	for _, su := range saved.Users {
+		user := &User{
+			ID:           su.ID,
+			Username:     su.Username,
+			Karma:        su.Karma,
+			PostKarma:    su.PostKarma,
+			CommentKarma: su.CommentKarma,
+			Connected:    su.Connected,
+			ShowNSFW:     su.ShowNSFW,
+			CreatedAt:    su.CreatedAt,
+			Blocked:      make(map[int]bool),
+			Saved:        make(map[int]bool),
+		}
+		user.Actions.Store(su.Actions)
+		for _, id := range su.Blocked {
+			user.Blocked[id] = true
+		}
+		for subReddit, karma := range su.SubRedditKarma {
+			e.subRedditKarma[subRedditKarmaKey{user.ID, subReddit}] = karma
+		}
+		for _, id := range su.Saved {
+			user.Saved[id] = true
+			user.savedOrder = append(user.savedOrder, id)
+		}
+		e.Users[user.ID] = user
+		e.usernames[strings.ToLower(user.Username)] = user.ID
+	}
+
+	for _, ss := range saved.SubReddits {
+		subReddit := &SubReddit{
+			Name:            subRedditKey(ss.Name),
+			DisplayName:     ss.DisplayName,
+			Posts:           []*Post{},
+			Users:           make(map[int]*User),
+			Moderators:      make(map[int]*User),
+			Banned:          make(map[int]bool),
+			Private:         ss.Private,
+			PendingRequests: []*User{},
+			RestrictPosting: ss.RestrictPosting,
+			MinKarmaToPost:  ss.MinKarmaToPost,
+			Description:     ss.Description,
+			Rules:           ss.Rules,
+			ModLog:          ss.ModLog,
+			Reports:         ss.Reports,
+		}
+		if subReddit.DisplayName == "" {
+			subReddit.DisplayName = ss.Name
+		}
+		for _, id := range ss.Members {
+			subReddit.Users[id] = e.resolveUser(id)
+		}
+		for _, id := range ss.Moderators {
+			subReddit.Moderators[id] = e.resolveUser(id)
+		}
+		for _, id := range ss.Banned {
+			subReddit.Banned[id] = true
+		}
+		for _, id := range ss.PendingRequests {
+			subReddit.PendingRequests = append(subReddit.PendingRequests, e.resolveUser(id))
+		}
+		for _, sp := range ss.Posts {
+			post := &Post{
+				ID:             sp.ID,
+				SubReddit:      subReddit.Name,
+				Author:         e.resolveUser(sp.AuthorID),
+				Content:        sp.Content,
+				Comments:       e.loadComments(sp.ID, sp.Comments),
+				Upvotes:        sp.Upvotes,
+				Downvotes:      sp.Downvotes,
+				Voters:         sp.Voters,
+				CreatedAt:      sp.CreatedAt,
+				OriginalPostID: sp.OriginalPostID,
+				IsRepost:       sp.IsRepost,
+				Awards:         sp.Awards,
+				Flair:          sp.Flair,
+				IsCrossPost:    sp.IsCrossPost,
+				CrossPostCount: sp.CrossPostCount,
+				Edited:         sp.Edited,
+				EditedAt:       sp.EditedAt,
+				Locked:         sp.Locked,
+				Pinned:         sp.Pinned,
+				NSFW:           sp.NSFW,
+				Published:      true,
+				voteKarma:      sp.VoteKarma,
+				awardKarma:     sp.AwardKarma,
+				PublishAt:      sp.PublishAt,
+			}
+			post.CommentCount = countComments(post.Comments)
+			if post.Voters == nil {
+				post.Voters = make(map[int]int)
+			}
+			subReddit.Posts = append(subReddit.Posts, post)
+			e.posts[post.ID] = post
+		}
+		e.SubReddits[subReddit.Name] = subReddit
+	}
+
+	for _, sm := range saved.Messages {
+		e.Messages = append(e.Messages, Message{
+			ID:      sm.ID,
+			From:    e.resolveUser(sm.FromID),
+			To:      e.resolveUser(sm.ToID),
+			Content: sm.Content,
+			SentAt:  sm.SentAt,
+			Read:    sm.Read,
+		})
+	}
+	for id, notifications := range saved.Notifications {
+		for _, sn := range notifications {
+			e.Notifications[id] = append(e.Notifications[id], Notification{
+				Type:      sn.Type,
+				FromUser:  e.resolveUser(sn.FromID),
+				PostID:    sn.PostID,
+				CommentID: sn.CommentID,
+				CreatedAt: sn.CreatedAt,
+				Read:      sn.Read,
+			})
+		}
+	}
+	for _, sp := range saved.Scheduled {
+		e.scheduled = append(e.scheduled, &Post{
+			ID:        sp.ID,
+			SubReddit: subRedditKey(sp.SubReddit),
+			Author:    e.resolveUser(sp.AuthorID),
+			Content:   sp.Content,
+			Comments:  []*Comment{},
+			Voters:    make(map[int]int),
+			PublishAt: sp.PublishAt,
+		})
+	}
+	// Saves from before messages had IDs load with ID 0; number them after
+	// the highest counter so every message stays addressable.
+	e.MessageID = max(e.MessageID, 1)
+	for i := range e.Messages {
+		if e.Messages[i].ID == 0 {
+			e.Messages[i].ID = e.MessageID
+			e.MessageID++
+		}
+	}
+	return e, nil
+}
+
+func (e *Engine) loadComments(postID int, saved []savedComment) []*Comment {
+	comments := []*Comment{}
+	for _, sc := range saved {
+		comments = append(comments, &Comment{
+			ID:        sc.ID,
+			PostID:    postID,
+			Author:    e.resolveUser(sc.AuthorID),
+			Content:   sc.Content,
+			Replies:   e.loadComments(postID, sc.Replies),
+			Upvotes:   sc.Upvotes,
+			Downvotes: sc.Downvotes,
+			CreatedAt: sc.CreatedAt,
+			Awards:    sc.Awards,
+			Edited:    sc.Edited,
+			EditedAt:  sc.EditedAt,
+			Removed:   sc.Removed,
+		})
+	}
+	return comments
+}
+
+func (e *Engine) resolveUser(id int) *User {
+	if user, exists := e.Users[id]; exists {
+		return user
+	}
+	return e.DeletedUser
+}
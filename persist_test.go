@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSaveAndLoadRoundTrip(t *testing.T) {
+	e := NewEngine()
+	setClock(e, testEpoch)
+	alice, _ := e.RegisterUser("alice")
+	bob, _ := e.RegisterUser("bob")
+	e.CreateSubReddit(alice, "golang")
+	e.JoinSubReddit(bob, "golang")
+	post, _ := e.CreatePost(alice, "golang", "generics")
+	e.UpvotePost(bob, post)
+	comment, _ := e.CommentPost(bob, post, "nice")
+	e.AddReplyToComment(alice, comment, "thanks")
+	e.SendDirectMessage(bob, alice, "hello")
+	e.MarkNotificationsRead(alice)
+	e.BlockUser(alice, bob)
+
+	var buf bytes.Buffer
+	if err := e.SaveToJSON(&buf); err != nil {
+		t.Fatalf("SaveToJSON: %v", err)
+	}
+	loaded, err := LoadFromJSON(&buf)
+	if err != nil {
+		t.Fatalf("LoadFromJSON: %v", err)
+	}
+
+	la, _ := loaded.GetUserByName("alice")
+	lb, _ := loaded.GetUserByName("bob")
+	if la == nil || lb == nil || la.ID != alice.ID || lb.ID != bob.ID {
+		t.Fatalf("users not restored: %+v, %+v", la, lb)
+	}
+	if la.Karma != alice.Karma || lb.CommentKarma != bob.CommentKarma || !la.Blocked[lb.ID] {
+		t.Fatal("user karma or blocks not restored")
+	}
+	sub, ok := loaded.GetSubReddit("golang")
+	if !ok || sub.Users[lb.ID] != lb || sub.Moderators[la.ID] != la {
+		t.Fatal("subreddit membership not rewired to loaded users")
+	}
+	lp, ok := loaded.GetPost(post.ID)
+	if !ok || lp.Author != la || lp.Score() != 1 || lp.Voters[lb.ID] != 1 {
+		t.Fatalf("post not restored: %+v", lp)
+	}
+	if len(sub.Posts) != 1 || sub.Posts[0] != lp {
+		t.Fatal("subreddit and post index disagree")
+	}
+	lc, ok := loaded.GetComment(post.ID, comment.ID)
+	if !ok || lc.Author != lb || len(lc.Replies) != 1 || lc.Replies[0].Author != la {
+		t.Fatalf("comment thread not restored: %+v", lc)
+	}
+	if len(loaded.Messages) != 1 || loaded.Messages[0].From != lb || loaded.Messages[0].To != la {
+		t.Fatal("message endpoints not rewired")
+	}
+	for _, user := range []*User{alice, bob} {
+		want, got := e.GetNotifications(user), loaded.GetNotifications(loaded.Users[user.ID])
+		if len(want) == 0 || len(got) != len(want) {
+			t.Fatalf("%s has %d notifications after reload, want %d", user.Username, len(got), len(want))
+		}
+		for i := range want {
+			if got[i].Type != want[i].Type || got[i].FromUser != loaded.Users[want[i].FromUser.ID] ||
+				got[i].CommentID != want[i].CommentID || got[i].Read != want[i].Read {
+				t.Fatalf("%s notification %d = %+v, want %+v", user.Username, i, got[i], want[i])
+			}
+		}
+	}
+	if loaded.TotalPosts.Load() != e.TotalPosts.Load() || loaded.TotalVotes.Load() != e.TotalVotes.Load() ||
+		loaded.TotalComments.Load() != e.TotalComments.Load() || loaded.TotalMessages.Load() != e.TotalMessages.Load() {
+		t.Fatal("counters differ after reload")
+	}
+
+	next, err := loaded.CreatePost(lb, "golang", "after reload")
+	if err != nil || next.ID <= post.ID {
+		t.Fatalf("CreatePost after reload = %v, %v; IDs must keep increasing", next, err)
+	}
+}
+
+func TestScheduledPostsSurviveReload(t *testing.T) {
+	e := NewEngine()
+	setClock(e, testEpoch)
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	scheduled, _ := e.SchedulePost(user, "sub", "later", testEpoch.Add(time.Hour))
+
+	var buf bytes.Buffer
+	if err := e.SaveToJSON(&buf); err != nil {
+		t.Fatalf("SaveToJSON: %v", err)
+	}
+	loaded, err := LoadFromJSON(&buf)
+	if err != nil {
+		t.Fatalf("LoadFromJSON: %v", err)
+	}
+	now := setClock(loaded, testEpoch)
+	if published := loaded.PublishDuePosts(); len(published) != 0 {
+		t.Fatalf("published %v before they were due", postIDs(published))
+	}
+	*now = testEpoch.Add(2 * time.Hour)
+	published := loaded.PublishDuePosts()
+	if len(published) != 1 {
+		t.Fatalf("published %d posts after reload, want the scheduled one", len(published))
+	}
+	got := published[0]
+	if got.ID != scheduled.ID || got.Content != "later" || got.Author != loaded.Users[user.ID] ||
+		!got.PublishAt.Equal(scheduled.PublishAt) || !got.Published {
+		t.Fatalf("reloaded scheduled post = %+v", got)
+	}
+}
@@ -0,0 +1,170 @@
+package engine
+
+import (
+	"sort"
+	"time"
+)
+
+// GetUserPosts lists every post the user has authored, newest first.
+func (e *Engine) GetUserPosts(userID int) []*Post {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	posts := []*Post{}
+	for _, subreddit := range e.SubReddits {
+		subreddit.Mutex.RLock()
+		for _, post := range subreddit.Posts {
+			if post.Author.ID == userID {
+				posts = append(posts, post)
+			}
+		}
+		subreddit.Mutex.RUnlock()
+	}
+	sortNew(posts)
+	return posts
+}
+
+// AuthorActivity counts the user's posts per time bucket, keyed by the start
+// of each bucket as given by time.Truncate. Buckets with no posts are absent.
+func (e *Engine) AuthorActivity(userID int, bucket time.Duration) map[time.Time]int {
+	activity := make(map[time.Time]int)
+	for _, post := range e.GetUserPosts(userID) {
+		activity[post.CreatedAt.Truncate(bucket)]++
+	}
+	return activity
+}
+
+// GetUserOverview merges the user's live posts and comments with the post
+// votes they currently stand behind, newest first. A vote is dated by its
+// last change in the activity log, or by its post's creation time if the log
+// no longer has it. Comment votes are anonymous, so they never appear.
+func (e *Engine) GetUserOverview(userID int) []ActivityEvent {
+	overview := []ActivityEvent{}
+	for _, post := range e.GetUserPosts(userID) {
+		kind := ActivityPost
+		if post.IsRepost {
+			kind = ActivityRepost
+		}
+		overview = append(overview, ActivityEvent{Type: kind, UserID: userID, TargetID: post.ID, SubReddit: post.SubReddit, Timestamp: post.CreatedAt})
+	}
+	for _, comment := range e.GetUserComments(userID) {
+		event := ActivityEvent{Type: ActivityComment, UserID: userID, TargetID: comment.ID, Timestamp: comment.CreatedAt}
+		if post, exists := e.GetPost(comment.PostID); exists {
+			event.SubReddit = post.SubReddit
+		}
+		overview = append(overview, event)
+	}
+	overview = append(overview, e.votesCast(userID)...)
+	sort.SliceStable(overview, func(i, j int) bool {
+		return overview[i].Timestamp.After(overview[j].Timestamp)
+	})
+	return overview
+}
+
+// votesCast returns an ActivityVote event for every post userID currently
+// has a vote on.
+func (e *Engine) votesCast(userID int) []ActivityEvent {
+	e.Mutex.RLock()
+	var votes []ActivityEvent
+	for _, subreddit := range e.SubReddits {
+		subreddit.Mutex.RLock()
+		for _, post := range subreddit.Posts {
+			if _, voted := post.Voters[userID]; voted {
+				votes = append(votes, ActivityEvent{Type: ActivityVote, UserID: userID, TargetID: post.ID, SubReddit: post.SubReddit, Timestamp: post.CreatedAt})
+			}
+		}
+		subreddit.Mutex.RUnlock()
+	}
+	e.Mutex.RUnlock()
+
+	lastVote := make(map[int]time.Time)
+	e.activityMu.Lock()
+	for _, event := range e.ActivityLog {
+		if event.Type == ActivityVote && event.UserID == userID {
+			lastVote[event.TargetID] = event.Timestamp
+		}
+	}
+	e.activityMu.Unlock()
+	for i, vote := range votes {
+		if at, logged := lastVote[vote.TargetID]; logged {
+			votes[i].Timestamp = at
+		}
+	}
+	return votes
+}
+
+// GetUserComments lists every comment and reply the user has written, newest
+// first.
+func (e *Engine) GetUserComments(userID int) []*Comment {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	comments := []*Comment{}
+	for _, subreddit := range e.SubReddits {
+		subreddit.Mutex.RLock()
+		for _, post := range subreddit.Posts {
+			comments = collectComments(comments, post.Comments, userID)
+		}
+		subreddit.Mutex.RUnlock()
+	}
+	sort.SliceStable(comments, func(i, j int) bool {
+		if !comments[i].CreatedAt.Equal(comments[j].CreatedAt) {
+			return comments[i].CreatedAt.After(comments[j].CreatedAt)
+		}
+		return comments[i].ID > comments[j].ID
+	})
+	return comments
+}
+
+func collectComments(dst, comments []*Comment, userID int) []*Comment {
+	for _, comment := range comments {
+		if comment.Author.ID == userID {
+			dst = append(dst, comment)
+		}
+		dst = collectComments(dst, comment.Replies, userID)
+	}
+	return dst
+}
+
+// SavePost bookmarks post for user. Saving an already-saved post does nothing.
+func (e *Engine) SavePost(user *User, post *Post) {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	if user.Saved == nil {
+		user.Saved = make(map[int]bool)
+	}
+	if user.Saved[post.ID] {
+		return
+	}
+	user.Saved[post.ID] = true
+	user.savedOrder = append(user.savedOrder, post.ID)
+	e.logActivity(ActivitySave, user.ID, post.ID, post.SubReddit)
+}
+
+func (e *Engine) UnsavePost(user *User, post *Post) {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	if !user.Saved[post.ID] {
+		return
+	}
+	delete(user.Saved, post.ID)
+	for i, id := range user.savedOrder {
+		if id == post.ID {
+			user.savedOrder = append(user.savedOrder[:i], user.savedOrder[i+1:]...)
+			break
+		}
+	}
+	e.logActivity(ActivityUnsave, user.ID, post.ID, post.SubReddit)
+}
+
+// GetSavedPosts lists the user's saved posts, most recently saved first.
+// Posts that have since been removed are skipped.
+func (e *Engine) GetSavedPosts(user *User) []*Post {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	posts := []*Post{}
+	for i := len(user.savedOrder) - 1; i >= 0; i-- {
+		if post, exists := e.GetPost(user.savedOrder[i]); exists {
+			posts = append(posts, post)
+		}
+	}
+	return posts
+}
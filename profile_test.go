@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGetUserOverviewShowsCurrentVotesOnly(t *testing.T) {
+	e := NewEngine()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	e.Clock = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+	author, _ := e.RegisterUser("author")
+	voter, _ := e.RegisterUser("voter")
+	e.CreateSubReddit(author, "sub")
+	kept, _ := e.CreatePost(author, "sub", "kept")
+	retracted, _ := e.CreatePost(author, "sub", "retracted")
+
+	e.UpvotePost(voter, kept)
+	e.DownvotePost(voter, kept)
+	e.UpvotePost(voter, retracted)
+	e.RemoveVote(voter, retracted)
+
+	overview := e.GetUserOverview(voter.ID)
+	if len(overview) != 1 {
+		t.Fatalf("overview has %d entries, want 1: %+v", len(overview), overview)
+	}
+	if vote := overview[0]; vote.Type != ActivityVote || vote.TargetID != kept.ID {
+		t.Fatalf("overview[0] = %+v, want a vote on post %d", vote, kept.ID)
+	}
+}
+
+// commentIDs lists the IDs of comments in order, for readable failure messages.
+func commentIDs(comments []*Comment) []int {
+	ids := make([]int, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+	return ids
+}
+
+func TestGetUserPostsAndCommentsNewestFirst(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	user, _ := e.RegisterUser("user")
+	other, _ := e.RegisterUser("other")
+	e.CreateSubReddit(user, "first")
+	e.CreateSubReddit(user, "second")
+
+	firstPost, _ := e.CreatePost(user, "first", "first post")
+	*now = now.Add(time.Minute)
+	foreign, _ := e.CreatePost(other, "second", "someone else's")
+	*now = now.Add(time.Minute)
+	secondPost, _ := e.CreatePost(user, "second", "second post")
+	*now = now.Add(time.Minute)
+	top, _ := e.CommentPost(user, foreign, "top-level")
+	*now = now.Add(time.Minute)
+	middle, _ := e.AddReplyToComment(other, top, "reply")
+	*now = now.Add(time.Minute)
+	nested, _ := e.AddReplyToComment(user, middle, "nested reply")
+	*now = now.Add(time.Minute)
+	onFirst, _ := e.CommentPost(user, firstPost, "on my own post")
+
+	if got, want := postIDs(e.GetUserPosts(user.ID)), postIDs([]*Post{secondPost, firstPost}); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("GetUserPosts = %v, want %v", got, want)
+	}
+	if got, want := commentIDs(e.GetUserComments(user.ID)), commentIDs([]*Comment{onFirst, nested, top}); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("GetUserComments = %v, want %v", got, want)
+	}
+	if got := e.GetUserPosts(other.ID + 1); len(got) != 0 {
+		t.Fatalf("unknown user has posts %v", postIDs(got))
+	}
+}
+
+func TestSavedPostsNewestSavedFirst(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	first, _ := e.CreatePost(user, "sub", "first")
+	second, _ := e.CreatePost(user, "sub", "second")
+	third, _ := e.CreatePost(user, "sub", "third")
+
+	e.SavePost(user, second)
+	e.SavePost(user, first)
+	e.SavePost(user, third)
+	e.SavePost(user, second)
+	if got, want := postIDs(e.GetSavedPosts(user)), postIDs([]*Post{third, first, second}); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("saved posts = %v, want %v", got, want)
+	}
+
+	e.UnsavePost(user, first)
+	e.UnsavePost(user, first)
+	if got, want := postIDs(e.GetSavedPosts(user)), postIDs([]*Post{third, second}); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("after unsaving = %v, want %v", got, want)
+	}
+	if user.Saved[first.ID] || !user.Saved[second.ID] {
+		t.Fatalf("Saved = %v", user.Saved)
+	}
+	e.SavePost(user, first)
+	if got := e.GetSavedPosts(user); got[0] != first {
+		t.Fatalf("re-saved post should come first, got %v", postIDs(got))
+	}
+}
+
+func TestAuthorActivityBucketsPosts(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	user, _ := e.RegisterUser("user")
+	other, _ := e.RegisterUser("other")
+	idle, _ := e.RegisterUser("idle")
+	e.CreateSubReddit(user, "sub")
+	for _, offset := range []time.Duration{0, 10 * time.Minute, 59 * time.Minute, 2*time.Hour + time.Minute, 5 * time.Hour} {
+		*now = testEpoch.Add(offset)
+		e.CreatePost(user, "sub", fmt.Sprintf("at %v", offset))
+	}
+	e.CreatePost(other, "sub", "not mine")
+
+	got := e.AuthorActivity(user.ID, time.Hour)
+	want := map[time.Time]int{
+		testEpoch:                    3,
+		testEpoch.Add(2 * time.Hour): 1,
+		testEpoch.Add(5 * time.Hour): 1,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("hourly activity = %v, want %v", got, want)
+	}
+	if daily := e.AuthorActivity(user.ID, 24*time.Hour); len(daily) != 1 || daily[testEpoch] != 5 {
+		t.Fatalf("daily activity = %v", daily)
+	}
+	if empty := e.AuthorActivity(idle.ID, time.Hour); empty == nil || len(empty) != 0 {
+		t.Fatalf("user with no posts = %v, want an empty map", empty)
+	}
+}
+
+func TestGetUserOverviewMergesNewestFirst(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	user, _ := e.RegisterUser("user")
+	other, _ := e.RegisterUser("other")
+	e.CreateSubReddit(other, "sub")
+	step := func() { *now = now.Add(time.Minute) }
+
+	step()
+	theirs, _ := e.CreatePost(other, "sub", "theirs")
+	step()
+	mine, _ := e.CreatePost(user, "sub", "mine")
+	step()
+	comment, _ := e.CommentPost(user, theirs, "comment")
+	step()
+	e.UpvotePost(user, theirs)
+	step()
+	reply, _ := e.AddReplyToComment(user, comment, "reply")
+	e.CommentPost(other, mine, "not mine")
+
+	want := []ActivityEvent{
+		{Type: ActivityComment, UserID: user.ID, TargetID: reply.ID, SubReddit: "sub", Timestamp: testEpoch.Add(5 * time.Minute)},
+		{Type: ActivityVote, UserID: user.ID, TargetID: theirs.ID, SubReddit: "sub", Timestamp: testEpoch.Add(4 * time.Minute)},
+		{Type: ActivityComment, UserID: user.ID, TargetID: comment.ID, SubReddit: "sub", Timestamp: testEpoch.Add(3 * time.Minute)},
+		{Type: ActivityPost, UserID: user.ID, TargetID: mine.ID, SubReddit: "sub", Timestamp: testEpoch.Add(2 * time.Minute)},
+	}
+	got := e.GetUserOverview(user.ID)
+	if len(got) != len(want) {
+		t.Fatalf("overview has %d entries, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("overview[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
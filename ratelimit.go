@@ -0,0 +1,66 @@
+package engine
+
+import "time"
+
+// RateLimit caps each user at Actions rate-limited actions per Window. A
+// zero Actions or Window disables limiting.
+type RateLimit struct {
+	Actions int
+	Window  time.Duration
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// tokensAt is how many tokens the bucket holds at now, after refilling for
+// the time elapsed since it was last touched.
+func (b *tokenBucket) tokensAt(limit RateLimit, now time.Time) float64 {
+	capacity := float64(limit.Actions)
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		return min(capacity, b.tokens+capacity*float64(elapsed)/float64(limit.Window))
+	}
+	return b.tokens
+}
+
+// allowAction spends one of user's tokens, refilling the bucket for the time
+// elapsed since it was last touched. It reports false once the bucket is empty.
+func (e *Engine) allowAction(user *User) bool {
+	limit := e.RateLimit
+	if limit.Actions <= 0 || limit.Window <= 0 {
+		return true
+	}
+	e.bucketsMu.Lock()
+	defer e.bucketsMu.Unlock()
+
+	now := e.now()
+	capacity := float64(limit.Actions)
+	bucket, exists := e.buckets[user.ID]
+	if !exists {
+		bucket = &tokenBucket{tokens: capacity, last: now}
+		e.buckets[user.ID] = bucket
+	}
+	bucket.tokens = bucket.tokensAt(limit, now)
+	if now.After(bucket.last) {
+		bucket.last = now
+	}
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// wouldAllowAction reports whether allowAction would succeed for user now,
+// without spending a token.
+func (e *Engine) wouldAllowAction(user *User) bool {
+	limit := e.RateLimit
+	if limit.Actions <= 0 || limit.Window <= 0 {
+		return true
+	}
+	e.bucketsMu.Lock()
+	defer e.bucketsMu.Unlock()
+	bucket, exists := e.buckets[user.ID]
+	return !exists || bucket.tokensAt(limit, e.now()) >= 1
+}
@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitExhaustsAndRecovers(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	e.RateLimit = RateLimit{Actions: 3, Window: time.Minute}
+	user, _ := e.RegisterUser("user")
+	other, _ := e.RegisterUser("other")
+	e.CreateSubReddit(user, "sub")
+
+	post, err := e.CreatePost(user, "sub", "post")
+	if err != nil {
+		t.Fatalf("CreatePost: %v", err)
+	}
+	if _, err := e.CommentPost(user, post, "comment"); err != nil {
+		t.Fatalf("CommentPost: %v", err)
+	}
+	if err := e.SendDirectMessage(user, other, "hi"); err != nil {
+		t.Fatalf("SendDirectMessage: %v", err)
+	}
+	if _, err := e.CreatePost(user, "sub", "one too many"); err != ErrRateLimited {
+		t.Fatalf("CreatePost over budget = %v, want ErrRateLimited", err)
+	}
+	if _, err := e.CommentPost(user, post, "one too many"); err != ErrRateLimited {
+		t.Fatalf("CommentPost over budget = %v, want ErrRateLimited", err)
+	}
+	if err := e.SendDirectMessage(user, other, "one too many"); err != ErrRateLimited {
+		t.Fatalf("SendDirectMessage over budget = %v, want ErrRateLimited", err)
+	}
+	if err := e.SendDirectMessage(other, user, "others are unaffected"); err != nil {
+		t.Fatalf("another user's message: %v", err)
+	}
+
+	*now = now.Add(20 * time.Second)
+	if _, err := e.CreatePost(user, "sub", "after a refill"); err != nil {
+		t.Fatalf("CreatePost after a third of the window: %v", err)
+	}
+	if _, err := e.CreatePost(user, "sub", "still short"); err != ErrRateLimited {
+		t.Fatalf("second CreatePost after a partial refill = %v, want ErrRateLimited", err)
+	}
+	*now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, err := e.CommentPost(user, post, "full budget"); err != nil {
+			t.Fatalf("comment %d after a full refill: %v", i, err)
+		}
+	}
+}
+
+func TestRepliesAreRateLimitedAndQueuedOffline(t *testing.T) {
+	e := NewEngine()
+	setClock(e, testEpoch)
+	author, _ := e.RegisterUser("author")
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(author, "sub")
+	post, _ := e.CreatePost(author, "sub", "post")
+	comment, _ := e.CommentPost(author, post, "comment")
+	e.RateLimit = RateLimit{Actions: 2, Window: time.Minute}
+
+	if _, err := e.AddReplyToComment(user, comment, "first"); err != nil {
+		t.Fatalf("AddReplyToComment: %v", err)
+	}
+	if _, err := e.AddReply(user, post.ID, comment.ID, "second"); err != nil {
+		t.Fatalf("AddReply: %v", err)
+	}
+	if _, err := e.AddReplyToComment(user, comment, "one too many"); err != ErrRateLimited {
+		t.Fatalf("AddReplyToComment over budget = %v, want ErrRateLimited", err)
+	}
+	if _, err := e.AddReply(user, post.ID, comment.ID, "one too many"); err != ErrRateLimited {
+		t.Fatalf("AddReply over budget = %v, want ErrRateLimited", err)
+	}
+	if len(comment.Replies) != 2 || post.CommentCount != 3 {
+		t.Fatalf("rejected replies were stored: %d replies, count %d", len(comment.Replies), post.CommentCount)
+	}
+
+	e.RateLimit = RateLimit{}
+	e.Disconnect(author)
+	if _, err := e.AddReplyToComment(author, comment, "queued"); err != ErrQueued {
+		t.Fatalf("offline AddReplyToComment = %v, want ErrQueued", err)
+	}
+	if _, err := e.AddReply(author, post.ID, comment.ID, "queued too"); err != ErrQueued {
+		t.Fatalf("offline AddReply = %v, want ErrQueued", err)
+	}
+	if len(comment.Replies) != 2 {
+		t.Fatal("offline replies ran before reconnecting")
+	}
+	e.Connect(author)
+	if len(comment.Replies) != 4 || comment.Replies[3].Content != "queued too" {
+		t.Fatalf("replies after reconnect = %d, want the two queued ones applied", len(comment.Replies))
+	}
+}
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"sort"
+	"time"
+)
+
+// SchedulePost queues a post for publication at publishAt. The post gets its
+// ID now, but it stays out of the subreddit, and out of the counters, until
+// PublishDuePosts runs at or after publishAt.
+func (e *Engine) SchedulePost(user *User, subRedditName, content string, publishAt time.Time) (*Post, error) {
+	if err := checkContent(content, e.MaxPostLength); err != nil {
+		return nil, err
+	}
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	subReddit, exists := e.SubReddits[subRedditKey(subRedditName)]
+	if !exists {
+		return nil, ErrSubRedditNotFound
+	}
+	subReddit.Mutex.RLock()
+	err := checkCanPost(subReddit, user, user.Karma)
+	subReddit.Mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if !e.allowAction(user) {
+		return nil, ErrRateLimited
+	}
+	post := &Post{
+		ID:        e.nextPostID(),
+		SubReddit: subReddit.Name,
+		Author:    user,
+		Content:   content,
+		Comments:  []*Comment{},
+		Voters:    make(map[int]int),
+		PublishAt: publishAt,
+	}
+	e.scheduled = append(e.scheduled, post)
+	e.logActivity(ActivitySchedulePost, user.ID, post.ID, subReddit.Name)
+	return post, nil
+}
+
+// PublishDuePosts publishes every scheduled post whose time has come, by the
+// engine clock, and returns them in publication order. A post whose author
+// can no longer post in its subreddit, or whose subreddit is gone, is dropped.
+func (e *Engine) PublishDuePosts() []*Post {
+	e.Mutex.Lock()
+	now := e.now()
+	var due []*Post
+	pending := e.scheduled[:0]
+	for _, post := range e.scheduled {
+		if post.PublishAt.After(now) {
+			pending = append(pending, post)
+		} else {
+			due = append(due, post)
+		}
+	}
+	e.scheduled = pending
+	e.Mutex.Unlock()
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].PublishAt.Before(due[j].PublishAt)
+	})
+
+	published := []*Post{}
+	for _, post := range due {
+		e.Mutex.RLock()
+		subReddit, exists := e.SubReddits[post.SubReddit]
+		karma := post.Author.Karma
+		e.Mutex.RUnlock()
+		if !exists {
+			continue
+		}
+		subReddit.Mutex.Lock()
+		err := checkCanPost(subReddit, post.Author, karma)
+		if subReddit.merged {
+			err = ErrSubRedditNotFound
+		}
+		if err == nil {
+			e.publishPost(subReddit, post)
+		}
+		subReddit.Mutex.Unlock()
+		if err != nil {
+			continue
+		}
+		e.streamPost(subReddit, post)
+		e.Mutex.Lock()
+		e.notifyMentions(post.Author, post.Content, post.ID, 0)
+		e.Mutex.Unlock()
+		published = append(published, post)
+	}
+	return published
+}
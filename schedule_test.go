@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeleteUserDropsScheduledPosts(t *testing.T) {
+	e := NewEngine()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	e.Clock = func() time.Time { return now }
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(nil, "sub")
+	if _, err := e.SchedulePost(user, "sub", "later", now.Add(time.Hour)); err != nil {
+		t.Fatalf("SchedulePost: %v", err)
+	}
+
+	e.DeleteUser(user.ID)
+	now = now.Add(2 * time.Hour)
+	if published := e.PublishDuePosts(); len(published) != 0 {
+		t.Fatalf("published %d posts by a deleted user", len(published))
+	}
+}
+
+func TestScheduledPostWaitsForClock(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	later, err := e.SchedulePost(user, "sub", "later", testEpoch.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("SchedulePost: %v", err)
+	}
+	sooner, _ := e.SchedulePost(user, "sub", "sooner", testEpoch.Add(time.Hour))
+	if later.Published || len(e.GetUserFeed(user)) != 0 || e.TotalPosts.Load() != 0 {
+		t.Fatal("scheduled post went live early")
+	}
+
+	if published := e.PublishDuePosts(); len(published) != 0 {
+		t.Fatalf("published %v before they were due", postIDs(published))
+	}
+	*now = testEpoch.Add(90 * time.Minute)
+	if published := e.PublishDuePosts(); len(published) != 1 || published[0] != sooner {
+		t.Fatalf("published %v, want only %d", postIDs(published), sooner.ID)
+	}
+	if feed := e.GetUserFeed(user); len(feed) != 1 || feed[0] != sooner || !sooner.Published {
+		t.Fatalf("feed after the first publish = %v", postIDs(feed))
+	}
+	*now = testEpoch.Add(3 * time.Hour)
+	if published := e.PublishDuePosts(); len(published) != 1 || published[0] != later {
+		t.Fatalf("published %v, want only %d", postIDs(published), later.ID)
+	}
+	if got := e.TotalPosts.Load(); got != 2 {
+		t.Fatalf("TotalPosts = %d, want 2", got)
+	}
+	if _, ok := e.GetPost(later.ID); !ok {
+		t.Fatal("published post is not indexed")
+	}
+}
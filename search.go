@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// SearchPosts returns every post whose content contains query, ignoring case,
+// ranked by votes.
+func (e *Engine) SearchPosts(query string) []*Post {
+	results, _ := e.SearchPostsContext(context.Background(), query)
+	return results
+}
+
+// SearchPostsContext is SearchPosts, abandoning the scan with ctx.Err() once
+// ctx is done.
+func (e *Engine) SearchPostsContext(ctx context.Context, query string) ([]*Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	results := []*Post{}
+	if query == "" {
+		return results, nil
+	}
+	query = strings.ToLower(query)
+	for _, subreddit := range e.SubReddits {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		results = append(results, matchPosts(subreddit, query)...)
+	}
+	sortByVotes(results)
+	return results, nil
+}
+
+func (e *Engine) SearchPostsInSubReddit(name, query string) ([]*Post, error) {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	subReddit, exists := e.SubReddits[subRedditKey(name)]
+	if !exists {
+		return nil, ErrSubRedditNotFound
+	}
+	results := []*Post{}
+	if query == "" {
+		return results, nil
+	}
+	results = append(results, matchPosts(subReddit, strings.ToLower(query))...)
+	sortByVotes(results)
+	return results, nil
+}
+
+// matchPosts returns the subreddit's posts containing the lowercased query.
+func matchPosts(subReddit *SubReddit, query string) []*Post {
+	subReddit.Mutex.RLock()
+	defer subReddit.Mutex.RUnlock()
+	var matches []*Post
+	for _, post := range subReddit.Posts {
+		if strings.Contains(strings.ToLower(post.Content), query) {
+			matches = append(matches, post)
+		}
+	}
+	return matches
+}
+
+func sortByVotes(posts []*Post) {
+	sort.SliceStable(posts, func(i, j int) bool {
+		if si, sj := posts[i].Score(), posts[j].Score(); si != sj {
+			return si > sj
+		}
+		return posts[i].ID < posts[j].ID
+	})
+}
+
+// SearchUsers returns users whose username starts with prefix, ignoring case,
+// in alphabetical order. An empty prefix matches everyone.
+func (e *Engine) SearchUsers(prefix string) []*User {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	prefix = strings.ToLower(prefix)
+	results := []*User{}
+	for _, user := range e.Users {
+		if strings.HasPrefix(strings.ToLower(user.Username), prefix) {
+			results = append(results, user)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		ni, nj := strings.ToLower(results[i].Username), strings.ToLower(results[j].Username)
+		if ni != nj {
+			return ni < nj
+		}
+		return results[i].ID < results[j].ID
+	})
+	return results
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestSearchPostsAcrossSubReddits(t *testing.T) {
+	e := NewEngine()
+	author, _ := e.RegisterUser("author")
+	voter, _ := e.RegisterUser("voter")
+	e.CreateSubReddit(author, "golang")
+	e.CreateSubReddit(author, "rust")
+	low, _ := e.CreatePost(author, "golang", "Learning GO generics")
+	high, _ := e.CreatePost(author, "rust", "go vs rust")
+	e.CreatePost(author, "rust", "borrow checker")
+	e.UpvotePost(voter, high)
+
+	got := postIDs(e.SearchPosts("Go"))
+	if want := []int{high.ID, low.ID}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("SearchPosts = %v, want %v", got, want)
+	}
+	if results := e.SearchPosts(""); results == nil || len(results) != 0 {
+		t.Fatalf("SearchPosts(\"\") = %v, want an empty slice", results)
+	}
+}
+
+func TestSearchPostsInSubReddit(t *testing.T) {
+	e := NewEngine()
+	author, _ := e.RegisterUser("author")
+	e.CreateSubReddit(author, "golang")
+	e.CreateSubReddit(author, "rust")
+	inside, _ := e.CreatePost(author, "golang", "go modules")
+	e.CreatePost(author, "rust", "go vs rust")
+
+	results, err := e.SearchPostsInSubReddit("golang", "GO")
+	if err != nil {
+		t.Fatalf("SearchPostsInSubReddit: %v", err)
+	}
+	if got := postIDs(results); fmt.Sprint(got) != fmt.Sprint([]int{inside.ID}) {
+		t.Fatalf("SearchPostsInSubReddit = %v, want [%d]", got, inside.ID)
+	}
+	if _, err := e.SearchPostsInSubReddit("missing", "go"); err != ErrSubRedditNotFound {
+		t.Fatalf("missing subreddit = %v, want ErrSubRedditNotFound", err)
+	}
+}
+
+// usernames lists the users' names in order.
+func usernames(users []*User) []string {
+	names := make([]string, len(users))
+	for i, user := range users {
+		names[i] = user.Username
+	}
+	return names
+}
+
+func TestSearchUsersByPrefix(t *testing.T) {
+	e := NewEngine()
+	e.RegisterUsers([]string{"bob", "Alice", "alfred", "carol"})
+
+	if got := fmt.Sprint(usernames(e.SearchUsers("al"))); got != "[alfred Alice]" {
+		t.Errorf("SearchUsers(al) = %s, want [alfred Alice]", got)
+	}
+	if got := fmt.Sprint(usernames(e.SearchUsers("BO"))); got != "[bob]" {
+		t.Errorf("SearchUsers(BO) = %s, want [bob]", got)
+	}
+	if got := fmt.Sprint(usernames(e.SearchUsers(""))); got != "[alfred Alice bob carol]" {
+		t.Errorf("SearchUsers(\"\") = %s, want everyone", got)
+	}
+	if got := e.SearchUsers("zed"); got == nil || len(got) != 0 {
+		t.Errorf("SearchUsers(zed) = %v, want an empty slice", got)
+	}
+}
+
+func TestSearchPostsContext(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("sub%d", i)
+		e.CreateSubReddit(user, name)
+		e.CreatePost(user, name, "gopher news")
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if results, err := e.SearchPostsContext(cancelled, "gopher"); err != context.Canceled || results != nil {
+		t.Fatalf("cancelled search = %v, %v; want nil, context.Canceled", results, err)
+	}
+	results, err := e.SearchPostsContext(context.Background(), "gopher")
+	if err != nil || len(results) != 3 {
+		t.Fatalf("live search = %d results, %v; want 3", len(results), err)
+	}
+	if got := e.SearchPosts("gopher"); fmt.Sprint(postIDs(got)) != fmt.Sprint(postIDs(results)) {
+		t.Fatalf("SearchPosts = %v, SearchPostsContext = %v", postIDs(got), postIDs(results))
+	}
+}
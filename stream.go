@@ -0,0 +1,57 @@
+package engine
+
+import "sync"
+
+// subscriberBuffer is how many posts a feed stream holds before new ones are
+// dropped.
+const subscriberBuffer = 64
+
+type feedSubscriber struct {
+	user *User
+	ch   chan *Post
+}
+
+// Subscribe opens a stream of posts published from now on in the subreddits
+// user belongs to at publication time. Posts the user's feed would hide, from
+// blocked authors or NSFW without ShowNSFW, are skipped. Delivery never
+// blocks: posts arriving while the buffer is full are dropped. The returned
+// function closes the stream and is safe to call more than once.
+func (e *Engine) Subscribe(user *User) (<-chan *Post, func()) {
+	sub := &feedSubscriber{user: user, ch: make(chan *Post, subscriberBuffer)}
+	e.subscribersMu.Lock()
+	e.subscribers[sub] = struct{}{}
+	e.subscribersMu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			e.subscribersMu.Lock()
+			defer e.subscribersMu.Unlock()
+			delete(e.subscribers, sub)
+			close(sub.ch)
+		})
+	}
+	return sub.ch, cancel
+}
+
+// streamPost offers a newly published post to every subscriber who belongs to
+// its subreddit and would see it in their feed. It reads blocks and NSFW
+// preferences under e.Mutex, so callers must hold neither e.Mutex nor
+// subReddit.Mutex.
+func (e *Engine) streamPost(subReddit *SubReddit, post *Post) {
+	e.Mutex.RLock()
+	defer e.Mutex.RUnlock()
+	subReddit.Mutex.RLock()
+	defer subReddit.Mutex.RUnlock()
+	e.subscribersMu.Lock()
+	defer e.subscribersMu.Unlock()
+	for sub := range e.subscribers {
+		if _, member := subReddit.Users[sub.user.ID]; !member || !visibleTo(post, sub.user) {
+			continue
+		}
+		select {
+		case sub.ch <- post:
+		default:
+		}
+	}
+}
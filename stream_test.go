@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSubscribeDeliversNewPostsUntilCancelled(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	poster, _ := e.RegisterUser("poster")
+	e.CreateSubReddit(poster, "joined")
+	e.CreateSubReddit(poster, "elsewhere")
+	e.JoinSubReddit(user, "joined")
+	e.CreatePost(poster, "joined", "before subscribing")
+
+	stream, cancel := e.Subscribe(user)
+	e.CreatePost(poster, "elsewhere", "not subscribed")
+	post, _ := e.CreatePost(poster, "joined", "after subscribing")
+	select {
+	case got := <-stream:
+		if got != post {
+			t.Fatalf("received post %d, want %d", got.ID, post.ID)
+		}
+	default:
+		t.Fatal("no post delivered")
+	}
+	select {
+	case got := <-stream:
+		t.Fatalf("unexpected post %d", got.ID)
+	default:
+	}
+
+	cancel()
+	cancel()
+	e.CreatePost(poster, "joined", "after cancelling")
+	if got, open := <-stream; open {
+		t.Fatalf("stream still delivering after cancel: post %d", got.ID)
+	}
+}
+
+func TestSubscribeDropsWhenBufferIsFull(t *testing.T) {
+	e := NewEngine()
+	user, _ := e.RegisterUser("user")
+	e.CreateSubReddit(user, "sub")
+	stream, cancel := e.Subscribe(user)
+	defer cancel()
+
+	for i := 0; i < subscriberBuffer+10; i++ {
+		if _, err := e.CreatePost(user, "sub", fmt.Sprintf("post %d", i)); err != nil {
+			t.Fatalf("CreatePost %d blocked or failed: %v", i, err)
+		}
+	}
+	if got := len(stream); got != subscriberBuffer {
+		t.Fatalf("stream holds %d posts, want a full buffer of %d", got, subscriberBuffer)
+	}
+}
+
+func TestSubscribeSkipsPostsTheFeedWouldHide(t *testing.T) {
+	e := NewEngine()
+	now := setClock(e, testEpoch)
+	user, _ := e.RegisterUser("user")
+	troll, _ := e.RegisterUser("troll")
+	poster, _ := e.RegisterUser("poster")
+	e.CreateSubReddit(poster, "sub")
+	e.JoinSubReddit(user, "sub")
+	e.JoinSubReddit(troll, "sub")
+	e.BlockUser(user, troll)
+	stream, cancel := e.Subscribe(user)
+	defer cancel()
+
+	e.CreatePost(troll, "sub", "from a blocked author")
+	select {
+	case got := <-stream:
+		t.Fatalf("blocked author's post %d was streamed", got.ID)
+	default:
+	}
+
+	nsfw, _ := e.SchedulePost(poster, "sub", "nsfw", testEpoch.Add(time.Minute))
+	nsfw.NSFW = true
+	*now = testEpoch.Add(time.Hour)
+	e.PublishDuePosts()
+	select {
+	case got := <-stream:
+		t.Fatalf("NSFW post %d was streamed with ShowNSFW off", got.ID)
+	default:
+	}
+
+	user.ShowNSFW = true
+	nsfw, _ = e.SchedulePost(poster, "sub", "nsfw again", testEpoch.Add(2*time.Hour))
+	nsfw.NSFW = true
+	*now = testEpoch.Add(3 * time.Hour)
+	e.PublishDuePosts()
+	select {
+	case got := <-stream:
+		if got != nsfw {
+			t.Fatalf("received post %d, want %d", got.ID, nsfw.ID)
+		}
+	default:
+		t.Fatal("NSFW post was not streamed after opting in")
+	}
+}